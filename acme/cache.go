@@ -0,0 +1,51 @@
+package acme
+
+import (
+	"context"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// S3Client is the subset of an S3 client an S3Cache needs. Callers
+// supply their own (e.g. aws-sdk-go's s3.S3), so this package takes no
+// direct dependency on a particular SDK.
+type S3Client interface {
+	GetObject(ctx context.Context, bucket, key string) (data []byte, found bool, err error)
+	PutObject(ctx context.Context, bucket, key string, data []byte) error
+	DeleteObject(ctx context.Context, bucket, key string) error
+}
+
+// S3Cache is an autocert.Cache backed by an S3 bucket, for deployments
+// that run multiple autograph instances behind a load balancer and
+// need their ACME certificate cache shared rather than per-instance.
+type S3Cache struct {
+	Client S3Client
+	Bucket string
+	Prefix string
+}
+
+func (c *S3Cache) objectKey(name string) string {
+	return c.Prefix + name
+}
+
+// Get implements autocert.Cache.
+func (c *S3Cache) Get(ctx context.Context, name string) ([]byte, error) {
+	data, found, err := c.Client.GetObject(ctx, c.Bucket, c.objectKey(name))
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, nil
+}
+
+// Put implements autocert.Cache.
+func (c *S3Cache) Put(ctx context.Context, name string, data []byte) error {
+	return c.Client.PutObject(ctx, c.Bucket, c.objectKey(name), data)
+}
+
+// Delete implements autocert.Cache.
+func (c *S3Cache) Delete(ctx context.Context, name string) error {
+	return c.Client.DeleteObject(ctx, c.Bucket, c.objectKey(name))
+}
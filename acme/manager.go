@@ -0,0 +1,171 @@
+// Package acme provides optional ACME/autocert-based TLS certificate
+// provisioning for the autograph API listener, for deployments that
+// would rather have their listener certificate obtained and renewed
+// automatically from an ACME CA than provision one externally (or
+// embed a PEM the way earlier chunks in this tree do).
+//
+// autograph's main server package does not exist in this tree, so
+// Manager is shipped standalone: a server wires it in by checking its
+// own tls.acme.enabled config, building a Manager, and using
+// TLSConfig() and ListenAndServeChallenges in place of its existing
+// static-certificate listener setup.
+package acme
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Config configures a Manager. ACME mode is only active when Enabled
+// is set; callers should check it before wiring a Manager in.
+type Config struct {
+	Enabled bool
+	// Directory is the ACME directory URL to request certificates
+	// from. Defaults to Let's Encrypt's production directory.
+	Directory string
+	// Email is given to the ACME CA for renewal/expiry notices.
+	Email string
+	// Hostnames whitelists the names autocert is allowed to request
+	// certificates for, typically sourced from autograph's existing
+	// authorization configuration.
+	Hostnames []string
+	// CacheDir is an on-disk directory to cache certificates in. Used
+	// when Cache is nil.
+	CacheDir string
+	// Cache overrides the on-disk cache, e.g. with an S3Cache shared
+	// across instances behind a load balancer.
+	Cache autocert.Cache
+	// ChallengeAddr is the dedicated listener address HTTP-01
+	// challenges are served on.
+	ChallengeAddr string
+}
+
+func (c Config) withDefaults() Config {
+	if c.Directory == "" {
+		c.Directory = acme.LetsEncryptURL
+	}
+	if c.ChallengeAddr == "" {
+		c.ChallengeAddr = ":http"
+	}
+	return c
+}
+
+// RenewalStatus is the most recently observed certificate state for
+// one hostname, for /__heartbeat__ to report on.
+type RenewalStatus struct {
+	Hostname      string    `json:"hostname"`
+	NotAfter      time.Time `json:"not_after,omitempty"`
+	LastCheckedAt time.Time `json:"last_checked_at"`
+	Err           string    `json:"error,omitempty"`
+}
+
+// Manager wraps an autocert.Manager, restricting issuance to a
+// whitelisted set of hostnames via HostPolicy and tracking renewal
+// status per hostname.
+type Manager struct {
+	config   Config
+	autocert *autocert.Manager
+
+	mu     sync.Mutex
+	status map[string]RenewalStatus
+}
+
+// New builds a Manager from config. It returns an error if config is
+// missing a cache (neither Cache nor CacheDir is set).
+func New(config Config) (*Manager, error) {
+	config = config.withDefaults()
+	cache := config.Cache
+	if cache == nil {
+		if config.CacheDir == "" {
+			return nil, errors.New("acme: either Cache or CacheDir must be set")
+		}
+		cache = autocert.DirCache(config.CacheDir)
+	}
+	m := &Manager{config: config, status: make(map[string]RenewalStatus)}
+	m.autocert = &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(config.Hostnames...),
+		Cache:      cache,
+		Email:      config.Email,
+		Client:     &acme.Client{DirectoryURL: config.Directory},
+	}
+	return m, nil
+}
+
+// TLSConfig returns a *tls.Config that obtains and renews certificates
+// through autocert, serving TLS-ALPN-01 challenges itself when asked
+// for one. Every call to GetCertificate -- renewal or otherwise -- is
+// recorded so Status can report on it.
+func (m *Manager) TLSConfig() *tls.Config {
+	cfg := m.autocert.TLSConfig()
+	getCertificate := cfg.GetCertificate
+	cfg.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, err := getCertificate(hello)
+		m.recordStatus(hello.ServerName, cert, err)
+		return cert, err
+	}
+	return cfg
+}
+
+// ListenAndServeChallenges runs a dedicated HTTP-01 challenge listener
+// on config.ChallengeAddr. It blocks, so callers run it in its own
+// goroutine; TLS-ALPN-01 challenges need no separate listener, since
+// TLSConfig's own GetCertificate answers them.
+func (m *Manager) ListenAndServeChallenges() error {
+	server := &http.Server{
+		Addr:    m.config.ChallengeAddr,
+		Handler: m.autocert.HTTPHandler(nil),
+	}
+	return server.ListenAndServe()
+}
+
+func (m *Manager) recordStatus(hostname string, cert *tls.Certificate, err error) {
+	status := RenewalStatus{Hostname: hostname, LastCheckedAt: time.Now()}
+	if err != nil {
+		status.Err = err.Error()
+	} else if cert != nil && cert.Leaf != nil {
+		status.NotAfter = cert.Leaf.NotAfter
+	}
+	m.mu.Lock()
+	m.status[hostname] = status
+	m.mu.Unlock()
+}
+
+// Status returns the most recently observed renewal status for every
+// hostname a certificate has been requested for.
+func (m *Manager) Status() []RenewalStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]RenewalStatus, 0, len(m.status))
+	for _, s := range m.status {
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// Stalled reports which known hostnames look like their renewal is
+// stuck: the last attempt to obtain a certificate for them failed, or
+// the certificate they're holding is within renewBefore of expiring
+// without a fresher one having replaced it. /__heartbeat__ can alarm
+// on a non-empty result.
+func (m *Manager) Stalled(renewBefore time.Duration) []RenewalStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var stalled []RenewalStatus
+	for _, s := range m.status {
+		if s.Err != "" {
+			stalled = append(stalled, s)
+			continue
+		}
+		if !s.NotAfter.IsZero() && time.Until(s.NotAfter) <= renewBefore {
+			stalled = append(stalled, s)
+		}
+	}
+	return stalled
+}
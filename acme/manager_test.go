@@ -0,0 +1,91 @@
+package acme
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewRequiresACache(t *testing.T) {
+	if _, err := New(Config{Hostnames: []string{"example.com"}}); err == nil {
+		t.Fatal("Expected New to fail without Cache or CacheDir set")
+	}
+}
+
+func TestManagerTracksRenewalStatus(t *testing.T) {
+	m, err := New(Config{
+		Hostnames: []string{"example.com"},
+		CacheDir:  filepath.Join(t.TempDir(), "acme-cache"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to build manager: %v", err)
+	}
+
+	m.recordStatus("example.com", nil, errTest{"renewal failed"})
+	stalled := m.Stalled(24 * time.Hour)
+	if len(stalled) != 1 || stalled[0].Err == "" {
+		t.Fatalf("Expected a failed renewal to show up as stalled, got %+v", stalled)
+	}
+
+	m.recordStatus("example.com", nil, nil)
+	statuses := m.Status()
+	if len(statuses) != 1 || statuses[0].Hostname != "example.com" {
+		t.Fatalf("Expected one tracked status for example.com, got %+v", statuses)
+	}
+	if len(m.Stalled(24*time.Hour)) != 0 {
+		t.Fatal("Expected a successful, un-expiring renewal not to show up as stalled")
+	}
+}
+
+type errTest struct{ msg string }
+
+func (e errTest) Error() string { return e.msg }
+
+func TestS3CacheTranslatesMiss(t *testing.T) {
+	client := &fakeS3Client{}
+	cache := &S3Cache{Client: client, Bucket: "certs", Prefix: "acme/"}
+	if _, err := cache.Get(context.Background(), "example.com"); err == nil {
+		t.Fatal("Expected a cache miss to return an error")
+	}
+
+	if err := cache.Put(context.Background(), "example.com", []byte("cert")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	data, err := cache.Get(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Failed to get after put: %v", err)
+	}
+	if string(data) != "cert" {
+		t.Fatalf("Unexpected cached data: %q", data)
+	}
+
+	if err := cache.Delete(context.Background(), "example.com"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, err := cache.Get(context.Background(), "example.com"); err == nil {
+		t.Fatal("Expected a cache miss after delete")
+	}
+}
+
+type fakeS3Client struct {
+	objects map[string][]byte
+}
+
+func (f *fakeS3Client) GetObject(ctx context.Context, bucket, key string) ([]byte, bool, error) {
+	data, ok := f.objects[key]
+	return data, ok, nil
+}
+
+func (f *fakeS3Client) PutObject(ctx context.Context, bucket, key string, data []byte) error {
+	if f.objects == nil {
+		f.objects = make(map[string][]byte)
+	}
+	f.objects[key] = data
+	return nil
+}
+
+func (f *fakeS3Client) DeleteObject(ctx context.Context, bucket, key string) error {
+	delete(f.objects, key)
+	return nil
+}
@@ -0,0 +1,48 @@
+package certmon
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// reissueResponse is the JSON body HandleReissueIntermediate returns on
+// success.
+type reissueResponse struct {
+	SerialNumber string `json:"serial_number"`
+	NotAfter     string `json:"not_after"`
+}
+
+// HandleReissueIntermediate serves POST
+// /signers/{id}/reissue-intermediate: it mints, cross-signs, and
+// hot-swaps a fresh intermediate for the named signer, if that
+// signer's key material is available locally.
+func (m *Monitor) HandleReissueIntermediate(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/signers/"), "/reissue-intermediate")
+	if id == "" || id == req.URL.Path {
+		http.Error(w, "missing signer id", http.StatusBadRequest)
+		return
+	}
+
+	cert, err := m.ReissueIntermediate(id)
+	if err != nil {
+		switch err {
+		case ErrUnknownSigner:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case ErrNotReissuable:
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reissueResponse{
+		SerialNumber: cert.SerialNumber.Text(16),
+		NotAfter:     cert.NotAfter.UTC().Format(http.TimeFormat),
+	})
+}
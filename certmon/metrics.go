@@ -0,0 +1,14 @@
+package certmon
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// certNotAfterGauge reports, per monitored certificate, the Unix
+// timestamp its notAfter falls on.
+var certNotAfterGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "autograph_cert_notafter_seconds",
+	Help: "Unix timestamp, in seconds, of a PEM-configured issuer or root certificate's notAfter.",
+}, []string{"signer", "cn", "ski"})
+
+func init() {
+	prometheus.MustRegister(certNotAfterGauge)
+}
@@ -0,0 +1,163 @@
+// Package certmon monitors the expiry of every PEM-configured issuer
+// and root certificate backing autograph's signers. It exports a
+// Prometheus gauge per certificate and calls an EventHandler for any
+// within a configurable warning or critical window of expiring. For
+// signers whose intermediate key material is available locally, it
+// can also mint a freshly cross-signed intermediate and hot-swap it
+// into the signer's chain without a restart -- see reissue.go.
+package certmon
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// CertSource is implemented by a signer with one or more PEM-configured
+// issuer or root certificates to monitor for expiry.
+type CertSource interface {
+	// ID returns the signer's configured identifier.
+	ID() string
+	// IssuerCertificates returns every issuer/root certificate this
+	// signer's chain depends on.
+	IssuerCertificates() []*x509.Certificate
+}
+
+// Severity classifies how close a certificate is to expiring.
+type Severity string
+
+const (
+	// SeverityWarning means a certificate is within Config.WarnDays of
+	// expiring.
+	SeverityWarning Severity = "warning"
+	// SeverityCritical means a certificate is within
+	// Config.CriticalDays of expiring, or has already expired.
+	SeverityCritical Severity = "critical"
+)
+
+// Event reports that a monitored certificate is within a configured
+// threshold of expiring.
+type Event struct {
+	SignerID      string
+	Subject       string
+	SKI           string
+	NotAfter      time.Time
+	DaysRemaining int
+	Severity      Severity
+}
+
+// EventHandler is called for every certificate that falls within
+// Config.WarnDays or Config.CriticalDays of expiring, on every Check
+// call. A handler that wants to avoid repeated alerts for the same
+// certificate is responsible for its own deduplication.
+type EventHandler func(Event)
+
+// Config tunes a Monitor's expiry thresholds and check interval.
+type Config struct {
+	// WarnDays is how many days before expiry a certificate starts
+	// generating SeverityWarning events.
+	WarnDays int
+	// CriticalDays is how many days before expiry a certificate starts
+	// generating SeverityCritical events.
+	CriticalDays int
+	// CheckInterval is how often Run re-checks every registered
+	// source.
+	CheckInterval time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.WarnDays == 0 {
+		c.WarnDays = 30
+	}
+	if c.CriticalDays == 0 {
+		c.CriticalDays = 7
+	}
+	if c.CheckInterval == 0 {
+		c.CheckInterval = time.Hour
+	}
+	return c
+}
+
+// Monitor tracks certificate expiry across every registered
+// CertSource.
+type Monitor struct {
+	config  Config
+	onEvent EventHandler
+
+	mu      sync.RWMutex
+	sources map[string]CertSource
+}
+
+// New builds a Monitor. onEvent may be nil, in which case expiry
+// events are simply not delivered anywhere; the Prometheus gauge is
+// still updated either way.
+func New(config Config, onEvent EventHandler) *Monitor {
+	return &Monitor{config: config.withDefaults(), onEvent: onEvent, sources: make(map[string]CertSource)}
+}
+
+// Register adds source to the set of signers Check and Run cover,
+// replacing any previously registered source with the same ID.
+func (m *Monitor) Register(source CertSource) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sources[source.ID()] = source
+}
+
+// Check runs one expiry pass over every registered source: it sets
+// autograph_cert_notafter_seconds for each certificate and calls
+// onEvent for any within Config.WarnDays or Config.CriticalDays of
+// expiring (including ones that have already expired).
+func (m *Monitor) Check() {
+	m.mu.RLock()
+	sources := make([]CertSource, 0, len(m.sources))
+	for _, s := range m.sources {
+		sources = append(sources, s)
+	}
+	m.mu.RUnlock()
+
+	for _, source := range sources {
+		for _, cert := range source.IssuerCertificates() {
+			ski := hex.EncodeToString(cert.SubjectKeyId)
+			certNotAfterGauge.WithLabelValues(source.ID(), cert.Subject.CommonName, ski).Set(float64(cert.NotAfter.Unix()))
+
+			days := int(time.Until(cert.NotAfter).Hours() / 24)
+			var severity Severity
+			switch {
+			case days <= m.config.CriticalDays:
+				severity = SeverityCritical
+			case days <= m.config.WarnDays:
+				severity = SeverityWarning
+			default:
+				continue
+			}
+			if m.onEvent != nil {
+				m.onEvent(Event{
+					SignerID:      source.ID(),
+					Subject:       cert.Subject.String(),
+					SKI:           ski,
+					NotAfter:      cert.NotAfter,
+					DaysRemaining: days,
+					Severity:      severity,
+				})
+			}
+		}
+	}
+}
+
+// Run calls Check once immediately, then again every
+// Config.CheckInterval until stop is closed. It blocks; callers
+// typically run it in its own goroutine.
+func (m *Monitor) Run(stop <-chan struct{}) {
+	m.Check()
+	ticker := time.NewTicker(m.config.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.Check()
+		}
+	}
+}
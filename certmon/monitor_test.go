@@ -0,0 +1,188 @@
+package certmon
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func makeCert(t *testing.T, cn string, notBefore, notAfter time.Time) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		SubjectKeyId:          []byte{0x01, 0x02, 0x03},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+type fakeCertSource struct {
+	id    string
+	certs []*x509.Certificate
+}
+
+func (f *fakeCertSource) ID() string                              { return f.id }
+func (f *fakeCertSource) IssuerCertificates() []*x509.Certificate { return f.certs }
+
+func TestCheckEmitsCriticalEventForExpiredCert(t *testing.T) {
+	expired, _ := makeCert(t, "expired intermediate", time.Now().Add(-48*time.Hour), time.Now().Add(-24*time.Hour))
+	var events []Event
+	m := New(Config{WarnDays: 30, CriticalDays: 7}, func(e Event) { events = append(events, e) })
+	m.Register(&fakeCertSource{id: "normankey", certs: []*x509.Certificate{expired}})
+
+	m.Check()
+
+	if len(events) != 1 {
+		t.Fatalf("Expected exactly one event for an expired certificate, got %d", len(events))
+	}
+	if events[0].Severity != SeverityCritical {
+		t.Fatalf("Expected SeverityCritical for an expired certificate, got %s", events[0].Severity)
+	}
+	if events[0].DaysRemaining >= 0 {
+		t.Fatalf("Expected negative DaysRemaining for an expired certificate, got %d", events[0].DaysRemaining)
+	}
+}
+
+func TestCheckEmitsNoEventForHealthyCert(t *testing.T) {
+	healthy, _ := makeCert(t, "healthy intermediate", time.Now().Add(-time.Hour), time.Now().Add(365*24*time.Hour))
+	var events []Event
+	m := New(Config{WarnDays: 30, CriticalDays: 7}, func(e Event) { events = append(events, e) })
+	m.Register(&fakeCertSource{id: "normankey", certs: []*x509.Certificate{healthy}})
+
+	m.Check()
+
+	if len(events) != 0 {
+		t.Fatalf("Expected no events for a certificate far from expiring, got %+v", events)
+	}
+}
+
+// testParentCA is a certmon.CAIssuer backed by an in-process key,
+// standing in for the real PKCS#11-backed parent CA in tests.
+type testParentCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func (c *testParentCA) Certificate() *x509.Certificate {
+	return c.cert
+}
+
+func (c *testParentCA) IssueCertificate(template *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, c.cert, pub, c.key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+type fakeReissuableSigner struct {
+	fakeCertSource
+	intermediate *x509.Certificate
+	key          *ecdsa.PrivateKey
+	parent       CAIssuer
+	swapped      *x509.Certificate
+}
+
+func (f *fakeReissuableSigner) Intermediate() *x509.Certificate { return f.intermediate }
+func (f *fakeReissuableSigner) Key() crypto.Signer              { return f.key }
+func (f *fakeReissuableSigner) Parent() CAIssuer                { return f.parent }
+func (f *fakeReissuableSigner) SwapIntermediate(newCert *x509.Certificate) error {
+	f.swapped = newCert
+	return nil
+}
+
+func TestReissueIntermediateHotSwapsFreshCert(t *testing.T) {
+	parentCert, parentKey := makeCert(t, "parent CA", time.Now().Add(-time.Hour), time.Now().Add(10*365*24*time.Hour))
+	expiredIntermediate, intermediateKey := makeCert(t, "content signing intermediate", time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour))
+
+	signer := &fakeReissuableSigner{
+		fakeCertSource: fakeCertSource{id: "normankey", certs: []*x509.Certificate{expiredIntermediate}},
+		intermediate:   expiredIntermediate,
+		key:            intermediateKey,
+		parent:         &testParentCA{cert: parentCert, key: parentKey},
+	}
+
+	m := New(Config{}, nil)
+	m.Register(signer)
+
+	fresh, err := m.ReissueIntermediate("normankey")
+	if err != nil {
+		t.Fatalf("ReissueIntermediate failed: %v", err)
+	}
+	if fresh.Subject.CommonName != expiredIntermediate.Subject.CommonName {
+		t.Fatalf("Expected reissued cert to keep the original subject, got %q", fresh.Subject.CommonName)
+	}
+	if string(fresh.SubjectKeyId) != string(expiredIntermediate.SubjectKeyId) {
+		t.Fatal("Expected reissued cert to keep the original SKI")
+	}
+	if !fresh.NotAfter.After(time.Now()) {
+		t.Fatal("Expected reissued cert to be valid in the future")
+	}
+	if err := fresh.CheckSignatureFrom(parentCert); err != nil {
+		t.Fatalf("Expected reissued cert to chain to the parent CA, got: %v", err)
+	}
+	if signer.swapped != fresh {
+		t.Fatal("Expected SwapIntermediate to be called with the freshly reissued certificate")
+	}
+}
+
+func TestReissueIntermediateUnknownSigner(t *testing.T) {
+	m := New(Config{}, nil)
+	if _, err := m.ReissueIntermediate("nosuchsigner"); err != ErrUnknownSigner {
+		t.Fatalf("Expected ErrUnknownSigner, got %v", err)
+	}
+}
+
+func TestReissueIntermediateNotReissuable(t *testing.T) {
+	cert, _ := makeCert(t, "normankey cert", time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	m := New(Config{}, nil)
+	m.Register(&fakeCertSource{id: "normankey", certs: []*x509.Certificate{cert}})
+	if _, err := m.ReissueIntermediate("normankey"); err != ErrNotReissuable {
+		t.Fatalf("Expected ErrNotReissuable, got %v", err)
+	}
+}
+
+func TestHandleReissueIntermediateHTTPStatuses(t *testing.T) {
+	m := New(Config{}, nil)
+	cert, _ := makeCert(t, "normankey cert", time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	m.Register(&fakeCertSource{id: "normankey", certs: []*x509.Certificate{cert}})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/signers/normankey/reissue-intermediate", nil)
+	m.HandleReissueIntermediate(rec, req)
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatalf("Expected 501 for a non-reissuable signer, got %d", rec.Code)
+	}
+
+	rec2 := httptest.NewRecorder()
+	req2 := httptest.NewRequest(http.MethodPost, "/signers/nosuchsigner/reissue-intermediate", nil)
+	m.HandleReissueIntermediate(rec2, req2)
+	if rec2.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for an unknown signer, got %d", rec2.Code)
+	}
+}
@@ -0,0 +1,101 @@
+package certmon
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReissuanceValidity is how long a freshly reissued intermediate is
+// valid for.
+const ReissuanceValidity = 5 * 365 * 24 * time.Hour
+
+// ErrUnknownSigner is returned by ReissueIntermediate when no
+// CertSource is registered under the given signer ID.
+var ErrUnknownSigner = errors.New("certmon: unknown signer")
+
+// ErrNotReissuable is returned by ReissueIntermediate when the
+// registered CertSource doesn't implement ReissuableSigner, meaning
+// its intermediate key material isn't available locally.
+var ErrNotReissuable = errors.New("certmon: signer does not support local intermediate reissuance")
+
+// CAIssuer is implemented by the signer backing an intermediate's
+// parent CA: it signs a certificate template with the parent key
+// without exposing it, the same delegation ocsp.CAIssuer and
+// crl.CAIssuer use elsewhere in this tree.
+type CAIssuer interface {
+	// Certificate returns the parent CA's own certificate.
+	Certificate() *x509.Certificate
+	// IssueCertificate signs template (whose PublicKey is ignored in
+	// favor of pub) with the parent CA key and returns the resulting
+	// certificate.
+	IssueCertificate(template *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error)
+}
+
+// ReissuableSigner is implemented by a signer whose intermediate
+// private key is available locally (as opposed to, say, behind a
+// PKCS#11 module that never exposes it), so Monitor can mint a fresh
+// intermediate ahead of expiry and hot-swap it in without a restart.
+type ReissuableSigner interface {
+	CertSource
+	// Intermediate returns the signer's current intermediate
+	// certificate.
+	Intermediate() *x509.Certificate
+	// Key returns the private key backing Intermediate(), so its
+	// public part can be reused in the reissued certificate.
+	Key() crypto.Signer
+	// Parent is the CA that must cross-sign the reissued
+	// intermediate.
+	Parent() CAIssuer
+	// SwapIntermediate hot-swaps newCert into the signer's active
+	// chain, taking effect on the signer's next signing operation.
+	SwapIntermediate(newCert *x509.Certificate) error
+}
+
+// ReissueIntermediate mints a fresh intermediate certificate for
+// signerID, reusing its current intermediate's subject, SKI, and key,
+// cross-signs it with the registered signer's Parent, hot-swaps it
+// into the signer's chain, and returns the new certificate.
+func (m *Monitor) ReissueIntermediate(signerID string) (*x509.Certificate, error) {
+	m.mu.RLock()
+	source, ok := m.sources[signerID]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownSigner
+	}
+	reissuable, ok := source.(ReissuableSigner)
+	if !ok {
+		return nil, ErrNotReissuable
+	}
+
+	current := reissuable.Intermediate()
+	key := reissuable.Key()
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "certmon: failed to generate reissued intermediate serial")
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               current.Subject,
+		SubjectKeyId:          current.SubjectKeyId,
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(ReissuanceValidity),
+		KeyUsage:              current.KeyUsage,
+		ExtKeyUsage:           current.ExtKeyUsage,
+		IsCA:                  current.IsCA,
+		BasicConstraintsValid: true,
+	}
+	fresh, err := reissuable.Parent().IssueCertificate(template, key.Public())
+	if err != nil {
+		return nil, errors.Wrapf(err, "certmon: failed to cross-sign reissued intermediate for signer %q", signerID)
+	}
+	if err := reissuable.SwapIntermediate(fresh); err != nil {
+		return nil, errors.Wrapf(err, "certmon: failed to hot-swap reissued intermediate for signer %q", signerID)
+	}
+	return fresh, nil
+}
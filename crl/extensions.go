@@ -0,0 +1,40 @@
+package crl
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+)
+
+// authorityKeyIdentifierOID is id-ce-authorityKeyIdentifier (RFC 5280
+// section 5.2.1), ties a CRL back to the issuer that signed it.
+var authorityKeyIdentifierOID = asn1.ObjectIdentifier{2, 5, 29, 35}
+
+// baseCRLNumberOID is id-ce-deltaCRLIndicator (RFC 5280 section 5.2.4),
+// present on a delta CRL to name the full CRL it is relative to.
+var baseCRLNumberOID = asn1.ObjectIdentifier{2, 5, 29, 27}
+
+type authorityKeyIdentifier struct {
+	KeyIdentifier []byte `asn1:"optional,tag:0"`
+}
+
+// authorityKeyIdentifierExtension builds the AuthorityKeyIdentifier
+// extension identifying ca as the issuer.
+func authorityKeyIdentifierExtension(ca *x509.Certificate) (pkix.Extension, error) {
+	val, err := asn1.Marshal(authorityKeyIdentifier{KeyIdentifier: ca.SubjectKeyId})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: authorityKeyIdentifierOID, Value: val}, nil
+}
+
+// baseCRLNumberExtension builds the deltaCRLIndicator extension naming
+// number as the full CRL a delta CRL is relative to.
+func baseCRLNumberExtension(number *big.Int) (pkix.Extension, error) {
+	val, err := asn1.Marshal(number)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: baseCRLNumberOID, Value: val}, nil
+}
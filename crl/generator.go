@@ -0,0 +1,243 @@
+// Package crl builds and serves signed X.509 v2 certificate revocation
+// lists covering everything revoked through the ocsp package's admin
+// API, complementing that package's OCSP responder. A Generator holds
+// the current full CRL (and, if configured, a delta CRL) in memory,
+// regenerating and re-validating it on a schedule so /crl/{ski}.crl
+// always has a fresh, signature-checked copy ready to serve.
+package crl
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.mozilla.org/autograph/ocsp"
+)
+
+// CAIssuer is implemented by the signer backing an embedded CA: it
+// signs a CRL template with the CA key without exposing it, the same
+// delegation ocsp.CAIssuer uses to issue delegated responder
+// certificates.
+type CAIssuer interface {
+	// Certificate returns the CA's own certificate.
+	Certificate() *x509.Certificate
+	// SignCRL signs template with the CA key and returns the
+	// DER-encoded CRL.
+	SignCRL(template *x509.RevocationList) ([]byte, error)
+}
+
+// Config tunes a Generator's regeneration schedule and CRL validity
+// windows.
+type Config struct {
+	// NextUpdate is how far in the future a freshly generated full
+	// CRL's nextUpdate field is set.
+	NextUpdate time.Duration
+	// RegenerateBefore triggers a fresh full CRL this long before the
+	// current one's nextUpdate.
+	RegenerateBefore time.Duration
+	// DeltaCRL enables publishing a delta CRL, covering certificates
+	// revoked since the last full CRL, alongside the full one.
+	DeltaCRL bool
+	// DeltaInterval is how often the delta CRL is regenerated, when
+	// DeltaCRL is set.
+	DeltaInterval time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.NextUpdate == 0 {
+		c.NextUpdate = 7 * 24 * time.Hour
+	}
+	if c.RegenerateBefore == 0 {
+		c.RegenerateBefore = 24 * time.Hour
+	}
+	if c.DeltaInterval == 0 {
+		c.DeltaInterval = time.Hour
+	}
+	return c
+}
+
+// Generator builds, validates, and holds the current signed CRL for
+// caIssuer, consulting store for the set of revoked serials.
+type Generator struct {
+	caIssuer CAIssuer
+	store    ocsp.Store
+	config   Config
+
+	mu         sync.RWMutex
+	number     *big.Int
+	current    *x509.RevocationList
+	currentDER []byte
+	fullNumber *big.Int
+	deltaSince time.Time
+	deltaDER   []byte
+}
+
+// New builds a Generator for caIssuer and store, generating and
+// validating its first full CRL before returning.
+func New(caIssuer CAIssuer, store ocsp.Store, config Config) (*Generator, error) {
+	g := &Generator{caIssuer: caIssuer, store: store, config: config.withDefaults(), number: big.NewInt(0)}
+	if err := g.regenerateFull(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// regenerateFull builds a fresh full CRL covering every entry in
+// g.store, validates it, and swaps it in. It refuses to adopt a CRL
+// that fails validation, leaving the previously published one in
+// place.
+func (g *Generator) regenerateFull() error {
+	entries, err := g.store.List()
+	if err != nil {
+		return errors.Wrap(err, "crl: failed to list revoked certificates")
+	}
+
+	g.mu.Lock()
+	g.number = new(big.Int).Add(g.number, big.NewInt(1))
+	number := new(big.Int).Set(g.number)
+	g.mu.Unlock()
+
+	der, generatedAt, err := g.sign(number, entries, nil)
+	if err != nil {
+		return err
+	}
+	parsed, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return errors.Wrap(err, "crl: failed to parse freshly signed CRL")
+	}
+
+	g.mu.Lock()
+	g.current = parsed
+	g.currentDER = der
+	g.fullNumber = number
+	g.deltaSince = generatedAt
+	g.deltaDER = nil
+	g.mu.Unlock()
+	return nil
+}
+
+// regenerateDelta builds a fresh delta CRL covering only entries
+// revoked since the last full CRL was generated, validates it, and
+// swaps it in.
+func (g *Generator) regenerateDelta() error {
+	entries, err := g.store.List()
+	if err != nil {
+		return errors.Wrap(err, "crl: failed to list revoked certificates")
+	}
+
+	g.mu.RLock()
+	since := g.deltaSince
+	base := g.fullNumber
+	g.mu.RUnlock()
+
+	var delta []ocsp.Entry
+	for _, e := range entries {
+		if e.RevokedAt.After(since) {
+			delta = append(delta, e)
+		}
+	}
+
+	g.mu.Lock()
+	g.number = new(big.Int).Add(g.number, big.NewInt(1))
+	number := new(big.Int).Set(g.number)
+	g.mu.Unlock()
+
+	der, _, err := g.sign(number, delta, base)
+	if err != nil {
+		return err
+	}
+	if _, err := x509.ParseRevocationList(der); err != nil {
+		return errors.Wrap(err, "crl: failed to parse freshly signed delta CRL")
+	}
+
+	g.mu.Lock()
+	g.deltaDER = der
+	g.mu.Unlock()
+	return nil
+}
+
+// sign builds a CRL template numbered number, covering entries, signs
+// it via g.caIssuer, and validates the result before returning it.
+// baseNumber, if non-nil, marks the CRL as a delta relative to that
+// full CRL's number.
+func (g *Generator) sign(number *big.Int, entries []ocsp.Entry, baseNumber *big.Int) ([]byte, time.Time, error) {
+	revoked := make([]pkix.RevokedCertificate, 0, len(entries))
+	for _, e := range entries {
+		serial, ok := new(big.Int).SetString(e.SerialNumber, 16)
+		if !ok {
+			return nil, time.Time{}, errors.Errorf("crl: revocation entry has malformed serial %q", e.SerialNumber)
+		}
+		revoked = append(revoked, pkix.RevokedCertificate{
+			SerialNumber:   serial,
+			RevocationTime: e.RevokedAt,
+		})
+	}
+
+	aki, err := authorityKeyIdentifierExtension(g.caIssuer.Certificate())
+	if err != nil {
+		return nil, time.Time{}, errors.Wrap(err, "crl: failed to build authority key identifier extension")
+	}
+	extensions := []pkix.Extension{aki}
+	if baseNumber != nil {
+		bcn, err := baseCRLNumberExtension(baseNumber)
+		if err != nil {
+			return nil, time.Time{}, errors.Wrap(err, "crl: failed to build base CRL number extension")
+		}
+		extensions = append(extensions, bcn)
+	}
+
+	now := time.Now()
+	template := &x509.RevocationList{
+		Number:              number,
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(g.config.NextUpdate),
+		RevokedCertificates: revoked,
+		ExtraExtensions:     extensions,
+	}
+	der, err := g.caIssuer.SignCRL(template)
+	if err != nil {
+		return nil, time.Time{}, errors.Wrap(err, "crl: failed to sign CRL")
+	}
+	if err := Validate(der, g.caIssuer.Certificate()); err != nil {
+		return nil, time.Time{}, errors.Wrap(err, "crl: refusing to publish an invalid CRL")
+	}
+	return der, now, nil
+}
+
+// Run regenerates the full CRL once it is within config.RegenerateBefore
+// of its nextUpdate, and -- when config.DeltaCRL is set -- regenerates
+// the delta CRL every config.DeltaInterval. It blocks until stop is
+// closed; callers typically run it in its own goroutine.
+func (g *Generator) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	lastDelta := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			g.mu.RLock()
+			expiresIn := time.Until(g.current.NextUpdate)
+			g.mu.RUnlock()
+			if expiresIn <= g.config.RegenerateBefore {
+				if err := g.regenerateFull(); err != nil {
+					log.Printf("crl: failed to regenerate full CRL: %v", err)
+				}
+				lastDelta = time.Now()
+				continue
+			}
+			if g.config.DeltaCRL && time.Since(lastDelta) >= g.config.DeltaInterval {
+				if err := g.regenerateDelta(); err != nil {
+					log.Printf("crl: failed to regenerate delta CRL: %v", err)
+				}
+				lastDelta = time.Now()
+			}
+		}
+	}
+}
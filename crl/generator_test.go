@@ -0,0 +1,155 @@
+package crl
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mozilla.org/autograph/ocsp"
+)
+
+// testCAIssuer is a CAIssuer backed by an in-process key, standing in
+// for the real PKCS#11-backed CA signer in tests.
+type testCAIssuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCAIssuer(t *testing.T) *testCAIssuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test embedded CA"},
+		SubjectKeyId:          []byte{0xde, 0xad, 0xbe, 0xef},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCAIssuer{cert: cert, key: key}
+}
+
+func (c *testCAIssuer) Certificate() *x509.Certificate {
+	return c.cert
+}
+
+func (c *testCAIssuer) SignCRL(template *x509.RevocationList) ([]byte, error) {
+	return x509.CreateRevocationList(rand.Reader, template, c.cert, c.key)
+}
+
+func TestGeneratorPublishesValidatedCRL(t *testing.T) {
+	ca := newTestCAIssuer(t)
+	store := ocsp.NewMemoryStore()
+	revokedSerial := big.NewInt(99)
+	if err := store.Revoke(revokedSerial, 1, time.Now()); err != nil {
+		t.Fatalf("Failed to revoke serial: %v", err)
+	}
+
+	gen, err := New(ca, store, Config{})
+	if err != nil {
+		t.Fatalf("Failed to build generator: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/crl/deadbeef.crl", nil)
+	rec := httptest.NewRecorder()
+	gen.HandleCRL(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/pkix-crl" {
+		t.Fatalf("Unexpected Content-Type: %q", ct)
+	}
+	if rec.Header().Get("ETag") == "" || rec.Header().Get("Last-Modified") == "" {
+		t.Fatal("Expected ETag and Last-Modified to be set")
+	}
+
+	list, err := x509.ParseRevocationList(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse served CRL: %v", err)
+	}
+	if err := list.CheckSignatureFrom(ca.cert); err != nil {
+		t.Fatalf("Served CRL does not chain to issuer: %v", err)
+	}
+	found := false
+	for _, rc := range list.RevokedCertificates {
+		if rc.SerialNumber.Cmp(revokedSerial) == 0 {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("Expected the revoked serial to appear on the CRL")
+	}
+
+	etag := rec.Header().Get("ETag")
+	req2 := httptest.NewRequest(http.MethodGet, "/crl/deadbeef.crl", nil)
+	req2.Header.Set("If-None-Match", etag)
+	rec2 := httptest.NewRecorder()
+	gen.HandleCRL(rec2, req2)
+	if rec2.Code != http.StatusNotModified {
+		t.Fatalf("Expected 304 on matching If-None-Match, got %d", rec2.Code)
+	}
+}
+
+func TestValidateRejectsWrongIssuer(t *testing.T) {
+	ca := newTestCAIssuer(t)
+	other := newTestCAIssuer(t)
+	store := ocsp.NewMemoryStore()
+	gen, err := New(ca, store, Config{})
+	if err != nil {
+		t.Fatalf("Failed to build generator: %v", err)
+	}
+	if err := Validate(gen.currentDER, other.cert); err == nil {
+		t.Fatal("Expected validation against the wrong issuer to fail")
+	}
+}
+
+func TestDeltaCRLCoversOnlyRecentRevocations(t *testing.T) {
+	ca := newTestCAIssuer(t)
+	store := ocsp.NewMemoryStore()
+	gen, err := New(ca, store, Config{DeltaCRL: true})
+	if err != nil {
+		t.Fatalf("Failed to build generator: %v", err)
+	}
+
+	newSerial := big.NewInt(123)
+	if err := store.Revoke(newSerial, 1, time.Now()); err != nil {
+		t.Fatalf("Failed to revoke serial: %v", err)
+	}
+	if err := gen.regenerateDelta(); err != nil {
+		t.Fatalf("Failed to regenerate delta CRL: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/crl/deadbeef-delta.crl", nil)
+	rec := httptest.NewRecorder()
+	gen.HandleCRL(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for delta CRL, got %d", rec.Code)
+	}
+	list, err := x509.ParseRevocationList(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse delta CRL: %v", err)
+	}
+	if len(list.RevokedCertificates) != 1 || list.RevokedCertificates[0].SerialNumber.Cmp(newSerial) != 0 {
+		t.Fatalf("Expected delta CRL to contain only the newly revoked serial, got %+v", list.RevokedCertificates)
+	}
+}
@@ -0,0 +1,55 @@
+package crl
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HandleCRL serves GET /crl/{issuer-ski}.crl with the most recently
+// generated and validated full CRL, and, when config.DeltaCRL is set,
+// GET /crl/{issuer-ski}-delta.crl with the delta CRL. It sets
+// Last-Modified and ETag from the served CRL's contents and answers
+// 304 Not Modified when the client's If-None-Match matches.
+func (g *Generator) HandleCRL(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ski := fmt.Sprintf("%x", g.caIssuer.Certificate().SubjectKeyId)
+	name := strings.TrimPrefix(req.URL.Path, "/crl/")
+
+	g.mu.RLock()
+	der, modified := g.currentDER, g.current.ThisUpdate
+	deltaDER := g.deltaDER
+	g.mu.RUnlock()
+
+	switch name {
+	case ski + ".crl":
+		// full CRL, selected below
+	case ski + "-delta.crl":
+		if !g.config.DeltaCRL || deltaDER == nil {
+			http.NotFound(w, req)
+			return
+		}
+		der = deltaDER
+		if delta, err := x509.ParseRevocationList(deltaDER); err == nil {
+			modified = delta.ThisUpdate
+		}
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	etag := fmt.Sprintf("%q", fmt.Sprintf("%x", sha256.Sum256(der)))
+	w.Header().Set("Content-Type", "application/pkix-crl")
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	w.Header().Set("ETag", etag)
+	if req.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(der)
+}
@@ -0,0 +1,30 @@
+package crl
+
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Validate parses der as an X.509 CRL, confirms its signature chains to
+// issuer, and rejects one that is missing its CRLNumber extension or
+// already past its nextUpdate. A Generator runs this on every freshly
+// signed CRL before publishing it, the same is_signature_valid-style
+// check other CRL publishers run to avoid serving a broken list.
+func Validate(der []byte, issuer *x509.Certificate) error {
+	list, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return errors.Wrap(err, "crl: failed to parse CRL")
+	}
+	if err := list.CheckSignatureFrom(issuer); err != nil {
+		return errors.Wrap(err, "crl: signature does not chain to issuer")
+	}
+	if list.Number == nil {
+		return errors.New("crl: missing CRLNumber extension")
+	}
+	if time.Now().After(list.NextUpdate) {
+		return errors.New("crl: nextUpdate is already in the past")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package ocsp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// HandleOCSP serves both the GET and POST forms of an RFC 6960 OCSP
+// request: GET /ocsp/{base64-and-url-encoded DER request}, or POST
+// /ocsp with the DER request as the body. It signs its response with
+// the responder's current delegated certificate.
+func (r *Responder) HandleOCSP(w http.ResponseWriter, req *http.Request) {
+	var der []byte
+	switch req.Method {
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		der = body
+
+	case http.MethodGet:
+		encoded := strings.TrimPrefix(req.URL.Path, "/ocsp/")
+		if encoded == "" || encoded == req.URL.Path {
+			http.Error(w, "missing base64 OCSP request", http.StatusBadRequest)
+			return
+		}
+		unescaped, err := url.QueryUnescape(encoded)
+		if err != nil {
+			http.Error(w, "malformed OCSP request", http.StatusBadRequest)
+			return
+		}
+		der, err = base64.StdEncoding.DecodeString(unescaped)
+		if err != nil {
+			http.Error(w, "malformed base64 OCSP request", http.StatusBadRequest)
+			return
+		}
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ocspReq, err := ocsp.ParseRequest(der)
+	if err != nil {
+		http.Error(w, "failed to parse OCSP request", http.StatusBadRequest)
+		return
+	}
+
+	status := ocsp.Good
+	var revokedAt time.Time
+	reason := 0
+	entry, revoked, err := r.store.Lookup(ocspReq.SerialNumber)
+	if err != nil {
+		http.Error(w, "failed to check revocation status", http.StatusInternalServerError)
+		return
+	}
+	if revoked {
+		status = ocsp.Revoked
+		revokedAt = entry.RevokedAt
+		reason = entry.Reason
+	}
+
+	r.mu.RLock()
+	responderCert, responderKey := r.responderCert, r.responderKey
+	r.mu.RUnlock()
+
+	now := time.Now()
+	respDER, err := ocsp.CreateResponse(r.caIssuer.Certificate(), responderCert, ocsp.Response{
+		Status:           status,
+		SerialNumber:     ocspReq.SerialNumber,
+		ThisUpdate:       now,
+		NextUpdate:       now.Add(r.config.ResponseValidity),
+		RevokedAt:        revokedAt,
+		RevocationReason: reason,
+		Certificate:      responderCert,
+	}, responderKey)
+	if err != nil {
+		http.Error(w, "failed to sign OCSP response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(respDER)
+}
+
+// RevokeRequest is the body of the admin endpoint POST
+// /certificates/revoke.
+type RevokeRequest struct {
+	// SerialNumber is hex-encoded, with no separators.
+	SerialNumber string `json:"serial_number"`
+	// Reason is an RFC 5280 section 5.3.1 CRLReason value.
+	Reason int `json:"reason"`
+}
+
+// HandleRevoke serves POST /certificates/revoke: it records the
+// serial in RevokeRequest as revoked as of now, so subsequent
+// HandleOCSP calls report it as such. Unlike HandleOCSP, this is an
+// admin action, so it requires the caller to present r.config.RevokeSecret
+// (see authenticateRevoke).
+func (r *Responder) HandleRevoke(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !r.authenticateRevoke(req) {
+		http.Error(w, "missing or invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	var body RevokeRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	serial, ok := new(big.Int).SetString(body.SerialNumber, 16)
+	if !ok {
+		http.Error(w, "serial_number must be hex-encoded", http.StatusBadRequest)
+		return
+	}
+	if err := r.store.Revoke(serial, body.Reason, time.Now()); err != nil {
+		http.Error(w, "failed to record revocation", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
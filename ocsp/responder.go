@@ -0,0 +1,187 @@
+package ocsp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ocspNoCheckOID is id-pkix-ocsp-nocheck (RFC 6960 section 4.2.2.2.1):
+// present on a delegated responder cert, it tells OCSP clients not to
+// bother checking whether the responder cert itself is revoked.
+var ocspNoCheckOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+
+// ocspNoCheckExtension is the ASN.1 NULL-valued extension that encodes
+// ocspNoCheckOID.
+var ocspNoCheckExtension = pkix.Extension{Id: ocspNoCheckOID, Value: []byte{0x05, 0x00}}
+
+// CAIssuer is implemented by the signer backing an embedded CA whose
+// private key lives in an HSM/PKCS#11 module: it can sign a certificate
+// template without exposing that key. None of autograph's current
+// signer implementations expose this -- apk and contentsignature only
+// speak in terms of SignData's opaque blobs -- so a PKCS#11-backed CA
+// signer needs to implement it for a Responder to issue delegated OCSP
+// responder certs against it.
+type CAIssuer interface {
+	// IssueCertificate signs template (whose PublicKey is ignored in
+	// favor of pub) with the CA key and returns the resulting
+	// certificate.
+	IssueCertificate(template *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error)
+	// Certificate returns the CA's own certificate.
+	Certificate() *x509.Certificate
+}
+
+// Config tunes a Responder's delegated certificate lifecycle and
+// response freshness.
+type Config struct {
+	// ResponderValidity is how long each issued delegated responder
+	// certificate is valid for.
+	ResponderValidity time.Duration
+	// RotateBefore triggers a fresh responder certificate this long
+	// before the current one expires.
+	RotateBefore time.Duration
+	// ResponseValidity is how far in the future an OCSP response's
+	// NextUpdate is set.
+	ResponseValidity time.Duration
+	// CRLDistributionPoint, if set, is advertised on issued delegated
+	// responder certificates so clients that fall back to CRL checking
+	// know where to fetch the crl package's published CRL.
+	CRLDistributionPoint string
+
+	// RevokeSecret gates HandleRevoke, the admin endpoint that marks a
+	// certificate revoked: callers must present it as
+	// "Authorization: Bearer <RevokeSecret>". It is required, since
+	// HandleRevoke has no other access control of its own.
+	RevokeSecret string
+}
+
+func (c Config) withDefaults() Config {
+	if c.ResponderValidity == 0 {
+		c.ResponderValidity = 7 * 24 * time.Hour
+	}
+	if c.RotateBefore == 0 {
+		c.RotateBefore = 24 * time.Hour
+	}
+	if c.ResponseValidity == 0 {
+		c.ResponseValidity = time.Hour
+	}
+	return c
+}
+
+// Responder signs OCSP responses, per RFC 6960, for certificates issued
+// by caIssuer, consulting store for revocation state. It holds a
+// short-lived delegated responder certificate that it rotates itself
+// ahead of expiry, so the CA key never has to sign a response directly.
+type Responder struct {
+	caIssuer CAIssuer
+	store    Store
+	config   Config
+
+	mu            sync.RWMutex
+	responderCert *x509.Certificate
+	responderKey  crypto.Signer
+}
+
+// New builds a Responder for caIssuer and store, issuing its first
+// delegated responder certificate before returning.
+func New(caIssuer CAIssuer, store Store, config Config) (*Responder, error) {
+	config = config.withDefaults()
+	if config.RevokeSecret == "" {
+		return nil, errors.New("ocsp: RevokeSecret must be set to authenticate the /certificates/revoke admin endpoint")
+	}
+	r := &Responder{caIssuer: caIssuer, store: store, config: config}
+	if err := r.rotate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// authenticateRevoke checks req's Authorization header against
+// r.config.RevokeSecret, in constant time so the comparison itself
+// can't leak the secret through response-timing.
+func (r *Responder) authenticateRevoke(req *http.Request) bool {
+	const prefix = "Bearer "
+	got := req.Header.Get("Authorization")
+	if !strings.HasPrefix(got, prefix) {
+		return false
+	}
+	token := strings.TrimPrefix(got, prefix)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(r.config.RevokeSecret)) == 1
+}
+
+// rotate issues a fresh delegated OCSP responder certificate, signed by
+// r.caIssuer, carrying the id-kp-OCSPSigning EKU and the
+// id-pkix-ocsp-nocheck extension.
+func (r *Responder) rotate() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return errors.Wrap(err, "ocsp: failed to generate delegated responder key")
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return errors.Wrap(err, "ocsp: failed to generate delegated responder serial")
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "autograph delegated OCSP responder"},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(r.config.ResponderValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		ExtraExtensions: []pkix.Extension{
+			ocspNoCheckExtension,
+		},
+	}
+	if r.config.CRLDistributionPoint != "" {
+		template.CRLDistributionPoints = []string{r.config.CRLDistributionPoint}
+	}
+	cert, err := r.caIssuer.IssueCertificate(template, &key.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "ocsp: failed to issue delegated responder certificate")
+	}
+
+	r.mu.Lock()
+	r.responderCert = cert
+	r.responderKey = key
+	r.mu.Unlock()
+	return nil
+}
+
+// Run checks, once a minute, whether the current delegated responder
+// certificate is within r.config.RotateBefore of expiring and, if so,
+// rotates it. It blocks until stop is closed; callers typically run it
+// in its own goroutine.
+func (r *Responder) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.mu.RLock()
+			expiresIn := time.Until(r.responderCert.NotAfter)
+			r.mu.RUnlock()
+			if expiresIn > r.config.RotateBefore {
+				continue
+			}
+			if err := r.rotate(); err != nil {
+				log.Printf("ocsp: failed to rotate delegated responder certificate: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gocsp "golang.org/x/crypto/ocsp"
+)
+
+// testCAIssuer is a CAIssuer backed by an in-process key, standing in
+// for the real PKCS#11-backed CA signer in tests.
+type testCAIssuer struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCAIssuer(t *testing.T) *testCAIssuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test embedded CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCAIssuer{cert: cert, key: key}
+}
+
+func (c *testCAIssuer) IssueCertificate(template *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, c.cert, pub, c.key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+func (c *testCAIssuer) Certificate() *x509.Certificate {
+	return c.cert
+}
+
+func TestResponderIssuesOCSPSigningCertAndTracksRevocation(t *testing.T) {
+	ca := newTestCAIssuer(t)
+	store := NewMemoryStore()
+	responder, err := New(ca, store, Config{RevokeSecret: "test-revoke-secret"})
+	if err != nil {
+		t.Fatalf("Failed to build responder: %v", err)
+	}
+
+	if responder.responderCert.ExtKeyUsage[0] != x509.ExtKeyUsageOCSPSigning {
+		t.Fatal("Expected delegated responder cert to carry the OCSPSigning EKU")
+	}
+
+	serial := big.NewInt(42)
+	req, err := gocsp.CreateRequest(&x509.Certificate{SerialNumber: serial}, ca.cert, nil)
+	if err != nil {
+		t.Fatalf("Failed to build OCSP request: %v", err)
+	}
+	parsed, err := gocsp.ParseRequest(req)
+	if err != nil {
+		t.Fatalf("Failed to parse our own OCSP request: %v", err)
+	}
+
+	entry, revoked, err := store.Lookup(parsed.SerialNumber)
+	if err != nil || revoked || entry != nil {
+		t.Fatalf("Expected an unknown serial to start out unrevoked, got entry=%v revoked=%v err=%v", entry, revoked, err)
+	}
+
+	if err := store.Revoke(serial, 1, time.Now()); err != nil {
+		t.Fatalf("Failed to revoke serial: %v", err)
+	}
+	_, revoked, err = store.Lookup(serial)
+	if err != nil || !revoked {
+		t.Fatalf("Expected serial to be revoked after Revoke, got revoked=%v err=%v", revoked, err)
+	}
+}
+
+// TestHandleRevokeRequiresAuthentication guards against regressing to
+// an unauthenticated /certificates/revoke: anyone who can reach the
+// route must not be able to revoke a serial without presenting
+// Config.RevokeSecret.
+func TestHandleRevokeRequiresAuthentication(t *testing.T) {
+	ca := newTestCAIssuer(t)
+	store := NewMemoryStore()
+	responder, err := New(ca, store, Config{RevokeSecret: "test-revoke-secret"})
+	if err != nil {
+		t.Fatalf("Failed to build responder: %v", err)
+	}
+
+	body, err := json.Marshal(RevokeRequest{SerialNumber: "2a", Reason: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRequest := func(authHeader string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/certificates/revoke", bytes.NewReader(body))
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		return req
+	}
+
+	rec := httptest.NewRecorder()
+	responder.HandleRevoke(rec, newRequest(""))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected request with no credentials to be rejected, got status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	responder.HandleRevoke(rec, newRequest("Bearer wrong-secret"))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected request with the wrong secret to be rejected, got status %d", rec.Code)
+	}
+
+	serial, _ := new(big.Int).SetString("2a", 16)
+	if _, revoked, _ := store.Lookup(serial); revoked {
+		t.Fatal("serial must not be revoked by unauthenticated requests")
+	}
+
+	rec = httptest.NewRecorder()
+	responder.HandleRevoke(rec, newRequest("Bearer test-revoke-secret"))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected request with the correct secret to succeed, got status %d", rec.Code)
+	}
+	if _, revoked, _ := store.Lookup(serial); !revoked {
+		t.Fatal("expected serial to be revoked after an authenticated request")
+	}
+}
+
+func TestFileStorePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.journal")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+	serial := big.NewInt(7)
+	if err := store.Revoke(serial, 1, time.Now()); err != nil {
+		t.Fatalf("Failed to revoke serial: %v", err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file store: %v", err)
+	}
+	_, revoked, err := reopened.Lookup(serial)
+	if err != nil || !revoked {
+		t.Fatalf("Expected revocation to survive reopening the journal, got revoked=%v err=%v", revoked, err)
+	}
+}
@@ -0,0 +1,136 @@
+// Package ocsp implements a built-in RFC 6960 OCSP responder for
+// certificates autograph itself issues: /ocsp answers GET (base64) and
+// POST requests with responses signed by a short-lived delegated
+// responder certificate, so the CA private key backing an embedded
+// issuer never has to sign anything but that delegation itself.
+package ocsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Entry is one revoked certificate's record.
+type Entry struct {
+	SerialNumber string    `json:"serial_number"` // hex, no separators
+	Reason       int       `json:"reason"`
+	RevokedAt    time.Time `json:"revoked_at"`
+}
+
+// Store is pluggable revocation state, populated by POST
+// /certificates/revoke: in-memory, file-backed, or (by implementing
+// this interface against a database driver) any other backing store.
+type Store interface {
+	Revoke(serial *big.Int, reason int, revokedAt time.Time) error
+	Lookup(serial *big.Int) (entry *Entry, revoked bool, err error)
+	// List returns every revoked entry, in no particular order, for
+	// callers -- such as the crl package -- that need the full
+	// revocation set rather than a single lookup.
+	List() ([]Entry, error)
+}
+
+// MemoryStore is a Store held entirely in memory; state is lost on
+// restart, which is fine for tests or a deployment that tolerates it.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]Entry
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry)}
+}
+
+// Revoke records serial as revoked.
+func (m *MemoryStore) Revoke(serial *big.Int, reason int, revokedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := serial.Text(16)
+	m.entries[key] = Entry{SerialNumber: key, Reason: reason, RevokedAt: revokedAt}
+	return nil
+}
+
+// Lookup reports whether serial has been revoked.
+func (m *MemoryStore) Lookup(serial *big.Int) (*Entry, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.entries[serial.Text(16)]
+	if !ok {
+		return nil, false, nil
+	}
+	return &e, true, nil
+}
+
+// List returns every revoked entry.
+func (m *MemoryStore) List() ([]Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make([]Entry, 0, len(m.entries))
+	for _, e := range m.entries {
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// FileStore is a Store backed by an append-only on-disk journal:
+// NewFileStore replays the file to rebuild an in-memory MemoryStore,
+// and Revoke appends a new record after updating it, the same
+// durability tradeoff quorum.JournalStore makes for pending jobs.
+type FileStore struct {
+	*MemoryStore
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileStore opens (creating if necessary) the revocation journal at
+// path and replays it into a FileStore.
+func NewFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ocsp: failed to open revocation journal %q", path)
+	}
+	defer f.Close()
+
+	mem := NewMemoryStore()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		mem.entries[e.SerialNumber] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "ocsp: failed to read revocation journal")
+	}
+	return &FileStore{MemoryStore: mem, path: path}, nil
+}
+
+// Revoke records serial as revoked and appends the record to the
+// journal file.
+func (fs *FileStore) Revoke(serial *big.Int, reason int, revokedAt time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.MemoryStore.Revoke(serial, reason, revokedAt); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fs.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "ocsp: failed to open revocation journal %q", fs.path)
+	}
+	defer f.Close()
+	data, err := json.Marshal(Entry{SerialNumber: serial.Text(16), Reason: reason, RevokedAt: revokedAt})
+	if err != nil {
+		return errors.Wrap(err, "ocsp: failed to serialize revocation entry")
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return errors.Wrapf(err, "ocsp: failed to append to revocation journal %q", fs.path)
+	}
+	return nil
+}
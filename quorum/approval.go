@@ -0,0 +1,85 @@
+package quorum
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DecisionApprove and DecisionDeny are the only valid
+	// ApprovalToken.Decision values.
+	DecisionApprove = "approve"
+	DecisionDeny    = "deny"
+)
+
+// tokenValidity bounds how far an ApprovalToken's timestamp may drift
+// from the server's clock, limiting the window a captured token could
+// be replayed in.
+const tokenValidity = 5 * time.Minute
+
+// ApprovalToken is what an approver POSTs to /quorum/approve/{jobid}.
+// It plays the role hawk's Authorization header does elsewhere in
+// autograph -- proving the holder of ApproverID's shared secret
+// produced this exact request -- as a self-contained HMAC scheme, so
+// this package doesn't need a dependency on the main server's hawk
+// stack.
+type ApprovalToken struct {
+	ApproverID string `json:"approver_id"`
+	Decision   string `json:"decision"`
+	Timestamp  int64  `json:"timestamp"`
+	Nonce      string `json:"nonce"`
+	// Share is the approver's plaintext Shamir share of the job key,
+	// recovered by decrypting their PendingJob.EncryptedShares entry
+	// with the private key matching Approver.SharePublicKey. Required
+	// when Decision is DecisionApprove; the server has no way to
+	// produce it on its own.
+	Share []byte `json:"share,omitempty"`
+	MAC   string `json:"mac"`
+}
+
+// Sign computes t.MAC over jobID and t's other fields, keyed by secret.
+// Callers build a token with ApproverID, Decision, Timestamp, Nonce and
+// (for an approval) Share set, call Sign, then POST the result.
+func (t *ApprovalToken) Sign(jobID, secret string) {
+	t.MAC = hex.EncodeToString(tokenMAC(jobID, *t, secret))
+}
+
+func tokenMAC(jobID string, t ApprovalToken, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s|%s|%s|%d|%s|%s", jobID, t.ApproverID, t.Decision, t.Timestamp, t.Nonce, hex.EncodeToString(t.Share))
+	return mac.Sum(nil)
+}
+
+// authenticate verifies token's MAC against the shared secret s.policy
+// declares for token.ApproverID, and rejects tokens whose timestamp has
+// drifted outside tokenValidity.
+func (s *Signer) authenticate(jobID string, token ApprovalToken) (string, error) {
+	approver := s.policy.find(token.ApproverID)
+	if approver == nil {
+		return "", errors.New("quorum: unknown approver")
+	}
+	if token.Decision != DecisionApprove && token.Decision != DecisionDeny {
+		return "", errors.New(`quorum: decision must be "approve" or "deny"`)
+	}
+	age := time.Since(time.Unix(token.Timestamp, 0))
+	if age < -tokenValidity || age > tokenValidity {
+		return "", errors.New("quorum: token timestamp is outside the validity window")
+	}
+	expected := tokenMAC(jobID, ApprovalToken{
+		ApproverID: token.ApproverID,
+		Decision:   token.Decision,
+		Timestamp:  token.Timestamp,
+		Nonce:      token.Nonce,
+		Share:      token.Share,
+	}, approver.Secret)
+	got, err := hex.DecodeString(token.MAC)
+	if err != nil || !hmac.Equal(expected, got) {
+		return "", errors.New("quorum: invalid token MAC")
+	}
+	return token.ApproverID, nil
+}
@@ -0,0 +1,20 @@
+package quorum
+
+import (
+	"log"
+	"time"
+)
+
+// auditApproval writes one audit log entry per recorded approval
+// decision.
+func auditApproval(jobID string, approval Approval) {
+	log.Printf("quorum audit: job=%s approver=%s decision=%s at=%s",
+		jobID, approval.ApproverID, approval.Decision, approval.Timestamp.Format(time.RFC3339))
+}
+
+// auditResolved writes one audit log entry when a job crosses its
+// approval threshold (or is denied) and leaves the pending state.
+func auditResolved(job *PendingJob) {
+	log.Printf("quorum audit: job=%s signer=%s resolved status=%s approvals=%d",
+		job.ID, job.SignerID, job.Status, len(job.Approvals))
+}
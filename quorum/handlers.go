@@ -0,0 +1,61 @@
+package quorum
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// HandleJob serves GET /quorum/jobs/{jobid}: it returns the job's
+// current state, including each approver's EncryptedShares entry, so
+// approval tooling can fetch and decrypt its own share before
+// submitting an ApprovalToken to HandleApprove.
+func (s *Signer) HandleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	jobID := strings.TrimPrefix(r.URL.Path, "/quorum/jobs/")
+	if jobID == "" || jobID == r.URL.Path {
+		http.Error(w, "missing job id", http.StatusBadRequest)
+		return
+	}
+	job, err := s.store.LoadJob(jobID)
+	if err != nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleApprove serves POST /quorum/approve/{jobid}: it decodes an
+// ApprovalToken from the request body, authenticates and records it via
+// s.Approve, and responds with the job's current state, which includes
+// the signature once the approval threshold has been reached.
+func (s *Signer) HandleApprove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	jobID := strings.TrimPrefix(r.URL.Path, "/quorum/approve/")
+	if jobID == "" || jobID == r.URL.Path {
+		http.Error(w, "missing job id", http.StatusBadRequest)
+		return
+	}
+
+	var token ApprovalToken
+	if err := json.NewDecoder(r.Body).Decode(&token); err != nil {
+		http.Error(w, "invalid approval token", http.StatusBadRequest)
+		return
+	}
+
+	job, err := s.Approve(jobID, token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
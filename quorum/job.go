@@ -0,0 +1,115 @@
+package quorum
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// shareKeySize is the length, in bytes, of an X25519 public key, which
+// is what Approver.SharePublicKey must hold.
+const shareKeySize = 32
+
+// JobStatus is the lifecycle state of a PendingJob.
+type JobStatus string
+
+const (
+	// JobPending means the job is still collecting approvals.
+	JobPending JobStatus = "pending"
+	// JobApproved means the approval threshold was met, the
+	// underlying signer has already run, and Signature is set.
+	JobApproved JobStatus = "approved"
+	// JobDenied means an approver denied the job; it will never be
+	// forwarded to the underlying signer.
+	JobDenied JobStatus = "denied"
+)
+
+// Approval is one approver's decision on a PendingJob, persisted
+// alongside it as its audit trail.
+type Approval struct {
+	ApproverID string    `json:"approver_id"`
+	Decision   string    `json:"decision"`
+	Timestamp  time.Time `json:"timestamp"`
+	// Share is the approver's plaintext Shamir share of the job key,
+	// carried over from ApprovalToken.Share on an approving decision.
+	// The server has no other way to recover it: see
+	// Approver.SharePublicKey.
+	Share []byte `json:"share,omitempty"`
+}
+
+// encryptedShare is one approver's Shamir share of a job's key, sealed
+// with box.SealAnonymous under that approver's SharePublicKey so it is
+// meaningless at rest without the matching private key, which the
+// server never holds.
+type encryptedShare struct {
+	SealedBox []byte `json:"sealed_box"`
+}
+
+// PendingJob is a signing request awaiting quorum approval. Its input
+// is encrypted under a random per-job key, which is split via Shamir's
+// Secret Sharing across the policy's approver group and only
+// reconstructed once enough approvers have approved. Its options are
+// not encrypted: they are stored as plain JSON in Options.
+type PendingJob struct {
+	ID       string `json:"id"`
+	SignerID string `json:"signer_id"`
+
+	Ciphertext []byte `json:"ciphertext"`
+	Nonce      []byte `json:"nonce"`
+	// Options holds the signing request's options, pre-encoded to JSON
+	// at job creation time. Storing it as json.RawMessage rather than
+	// interface{} means a reload from the journal hands resolveJob back
+	// the exact bytes originally submitted, instead of the generic
+	// map[string]interface{} encoding/json would otherwise produce --
+	// which the underlying signer's options decoding wouldn't recognize.
+	Options json.RawMessage `json:"options,omitempty"`
+
+	EncryptedShares map[string]encryptedShare `json:"encrypted_shares"`
+
+	Approvals []Approval `json:"approvals"`
+	Status    JobStatus  `json:"status"`
+
+	// Signature holds the underlying signer's marshaled output once
+	// Status is JobApproved.
+	Signature string `json:"signature,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newJobID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", errors.Wrap(err, "quorum: failed to generate job id")
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// encryptShare seals share so that only the holder of the private key
+// matching pubKey (an approver's Approver.SharePublicKey) can recover
+// it -- the server that calls this has no way to reverse it itself.
+func encryptShare(pubKey []byte, share []byte) (encryptedShare, error) {
+	if len(pubKey) != shareKeySize {
+		return encryptedShare{}, errors.New("quorum: share public key must be 32 bytes")
+	}
+	var pk [shareKeySize]byte
+	copy(pk[:], pubKey)
+	sealed, err := box.SealAnonymous(nil, share, &pk, rand.Reader)
+	if err != nil {
+		return encryptedShare{}, errors.Wrap(err, "quorum: failed to seal share")
+	}
+	return encryptedShare{SealedBox: sealed}, nil
+}
+
+func approvalCount(job *PendingJob, decision string) int {
+	count := 0
+	for _, a := range job.Approvals {
+		if a.Decision == decision {
+			count++
+		}
+	}
+	return count
+}
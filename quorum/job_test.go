@@ -0,0 +1,40 @@
+package quorum
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// TestShareEncryptionRequiresApproverPrivateKey guards against
+// regressing to a share-at-rest scheme the server can reverse on its
+// own: encryptShare must produce a sealed box that only the private key
+// matching the approver's SharePublicKey can open, so a server that
+// never receives that private key has no path to the plaintext share.
+func TestShareEncryptionRequiresApproverPrivateKey(t *testing.T) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate approver keypair: %v", err)
+	}
+	approver := Approver{ID: "alice", Secret: "alice-auth-secret", SharePublicKey: pub[:]}
+
+	share := []byte("a shamir share")
+	es, err := encryptShare(approver.SharePublicKey, share)
+	if err != nil {
+		t.Fatalf("encryptShare failed: %v", err)
+	}
+
+	var wrongKey [32]byte
+	if _, ok := box.OpenAnonymous(nil, es.SealedBox, pub, &wrongKey); ok {
+		t.Fatal("expected opening the sealed share with the wrong private key to fail")
+	}
+
+	opened, ok := box.OpenAnonymous(nil, es.SealedBox, pub, priv)
+	if !ok {
+		t.Fatal("expected opening the sealed share with the matching private key to succeed")
+	}
+	if string(opened) != string(share) {
+		t.Fatalf("opened share = %q, want %q", opened, share)
+	}
+}
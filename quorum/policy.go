@@ -0,0 +1,68 @@
+package quorum
+
+import "github.com/pkg/errors"
+
+// Approver is one member of a Policy's approver group: their identity,
+// the shared secret their ApprovalToken is authenticated with (see
+// Signer.authenticate), and the public key their Shamir share of a
+// job's key is sealed to at rest (see encryptShare).
+type Approver struct {
+	ID string `json:"id" yaml:"id"`
+	// Secret authenticates the approver's ApprovalToken. The server
+	// holds it to verify incoming approvals.
+	Secret string `json:"secret" yaml:"secret"`
+	// SharePublicKey is the approver's X25519 public key. The server
+	// only ever encrypts the approver's Shamir share under it
+	// (encryptShare uses box.SealAnonymous); the matching private key
+	// is kept by the approver and never given to the server. This is
+	// what makes the two-person rule actually hold: a server holding
+	// Secret (which it must, to verify approvals) still has no way to
+	// decrypt a share and reconstruct the job key by itself -- an
+	// approver has to decrypt their own EncryptedShare and submit the
+	// plaintext back in ApprovalToken.Share before it counts.
+	SharePublicKey []byte `json:"share_public_key" yaml:"share_public_key"`
+}
+
+// Policy is the two-person-rule configuration for one signer: the
+// number of distinct ApproverGroup members who must approve a pending
+// signing request before Signer forwards it to the underlying signer.
+type Policy struct {
+	MinApprovals  int        `json:"min_approvals" yaml:"min_approvals"`
+	ApproverGroup []Approver `json:"approver_group" yaml:"approver_group"`
+}
+
+func (p Policy) validate() error {
+	if p.MinApprovals < 1 {
+		return errors.New("quorum: min_approvals must be at least 1")
+	}
+	if p.MinApprovals > len(p.ApproverGroup) {
+		return errors.Errorf("quorum: min_approvals (%d) exceeds the approver group size (%d)", p.MinApprovals, len(p.ApproverGroup))
+	}
+	seen := make(map[string]bool, len(p.ApproverGroup))
+	for _, a := range p.ApproverGroup {
+		if a.ID == "" || a.Secret == "" {
+			return errors.New("quorum: every approver needs an id and a secret")
+		}
+		if len(a.SharePublicKey) != shareKeySize {
+			return errors.Errorf("quorum: approver %q needs a %d-byte share public key", a.ID, shareKeySize)
+		}
+		if seen[a.ID] {
+			return errors.Errorf("quorum: duplicate approver id %q", a.ID)
+		}
+		seen[a.ID] = true
+	}
+	return nil
+}
+
+func (p Policy) find(id string) *Approver {
+	for i := range p.ApproverGroup {
+		if p.ApproverGroup[i].ID == id {
+			return &p.ApproverGroup[i]
+		}
+	}
+	return nil
+}
+
+func (p Policy) isApprover(id string) bool {
+	return p.find(id) != nil
+}
@@ -0,0 +1,286 @@
+package quorum
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mozilla.org/autograph/signer"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// testApprover generates a fresh share keypair and returns the Approver
+// to configure the Policy with, plus the private key the approver
+// keeps, never handed to the Signer under test.
+func testApprover(t *testing.T, id, secret string) (Approver, *[32]byte) {
+	t.Helper()
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate share keypair for %q: %v", id, err)
+	}
+	return Approver{ID: id, Secret: secret, SharePublicKey: pub[:]}, priv
+}
+
+// approverShare decrypts approver's EncryptedShares entry on job with
+// their own keypair, the way real approval tooling would before
+// submitting an ApprovalToken.
+func approverShare(t *testing.T, job *PendingJob, approver Approver, priv *[32]byte) []byte {
+	t.Helper()
+	es, ok := job.EncryptedShares[approver.ID]
+	if !ok {
+		t.Fatalf("job has no encrypted share for %q", approver.ID)
+	}
+	var pub [32]byte
+	copy(pub[:], approver.SharePublicKey)
+	share, ok := box.OpenAnonymous(nil, es.SealedBox, &pub, priv)
+	if !ok {
+		t.Fatalf("failed to open sealed share for %q", approver.ID)
+	}
+	return share
+}
+
+// stubSignature is the fake signer.Signature recordingSigner returns.
+type stubSignature string
+
+func (s stubSignature) Marshal() (string, error) { return string(s), nil }
+
+// recordingSigner is a minimal signer.Signer used to test Signer
+// without depending on a real signing implementation.
+type recordingSigner struct {
+	id              string
+	received        []byte
+	receivedOptions interface{}
+}
+
+func (r *recordingSigner) Config() signer.Configuration {
+	return signer.Configuration{ID: r.id, Type: "stub"}
+}
+
+func (r *recordingSigner) SignData(input []byte, options interface{}) (signer.Signature, error) {
+	r.received = input
+	r.receivedOptions = options
+	return stubSignature("signed:" + string(input)), nil
+}
+
+func newTestToken(jobID, approverID, decision, secret string, share []byte) ApprovalToken {
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	token := ApprovalToken{
+		ApproverID: approverID,
+		Decision:   decision,
+		Timestamp:  time.Now().Unix(),
+		Nonce:      hex.EncodeToString(nonce),
+		Share:      share,
+	}
+	token.Sign(jobID, secret)
+	return token
+}
+
+func TestTwoPersonApprovalFlow(t *testing.T) {
+	store, err := NewJournalStore(filepath.Join(t.TempDir(), "quorum.journal"))
+	if err != nil {
+		t.Fatalf("Failed to create journal store: %v", err)
+	}
+	underlying := &recordingSigner{id: "normankey"}
+	alice, alicePriv := testApprover(t, "alice", "alice-secret")
+	bob, bobPriv := testApprover(t, "bob", "bob-secret")
+	carol, carolPriv := testApprover(t, "carol", "carol-secret")
+	policy := Policy{
+		MinApprovals:  2,
+		ApproverGroup: []Approver{alice, bob, carol},
+	}
+	qs, err := New(underlying, policy, store)
+	if err != nil {
+		t.Fatalf("Failed to build quorum signer: %v", err)
+	}
+
+	sig, err := qs.SignData([]byte("please sign this release"), nil)
+	if err != nil {
+		t.Fatalf("SignData failed: %v", err)
+	}
+	jobID, err := sig.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal pending signature: %v", err)
+	}
+	if underlying.received != nil {
+		t.Fatal("Expected underlying signer not to be called before quorum is reached")
+	}
+
+	job, err := store.LoadJob(jobID)
+	if err != nil {
+		t.Fatalf("Failed to load pending job: %v", err)
+	}
+
+	aliceShare := approverShare(t, job, alice, alicePriv)
+	job, err = qs.Approve(jobID, newTestToken(jobID, "alice", DecisionApprove, "alice-secret", aliceShare))
+	if err != nil {
+		t.Fatalf("First approval failed: %v", err)
+	}
+	if job.Status != JobPending {
+		t.Fatalf("Expected job to still be pending after 1 of 2 approvals, got status=%s", job.Status)
+	}
+
+	bobShare := approverShare(t, job, bob, bobPriv)
+	job, err = qs.Approve(jobID, newTestToken(jobID, "bob", DecisionApprove, "bob-secret", bobShare))
+	if err != nil {
+		t.Fatalf("Second approval failed: %v", err)
+	}
+	if job.Status != JobApproved {
+		t.Fatalf("Expected job to be approved after meeting the threshold, got status=%s", job.Status)
+	}
+	if job.Signature != "signed:please sign this release" {
+		t.Fatalf("Unexpected resolved signature: %q", job.Signature)
+	}
+	if string(underlying.received) != "please sign this release" {
+		t.Fatalf("Underlying signer received %q, expected original input", underlying.received)
+	}
+
+	carolShare := approverShare(t, job, carol, carolPriv)
+	if _, err := qs.Approve(jobID, newTestToken(jobID, "carol", DecisionApprove, "carol-secret", carolShare)); err == nil {
+		t.Fatal("Expected approving an already-resolved job to fail, but it succeeded")
+	}
+}
+
+func TestApprovalRejectsBadSecret(t *testing.T) {
+	store, err := NewJournalStore(filepath.Join(t.TempDir(), "quorum.journal"))
+	if err != nil {
+		t.Fatalf("Failed to create journal store: %v", err)
+	}
+	underlying := &recordingSigner{id: "normankey"}
+	alice, alicePriv := testApprover(t, "alice", "alice-secret")
+	policy := Policy{
+		MinApprovals:  1,
+		ApproverGroup: []Approver{alice},
+	}
+	qs, err := New(underlying, policy, store)
+	if err != nil {
+		t.Fatalf("Failed to build quorum signer: %v", err)
+	}
+	sig, err := qs.SignData([]byte("data"), nil)
+	if err != nil {
+		t.Fatalf("SignData failed: %v", err)
+	}
+	jobID, _ := sig.Marshal()
+
+	job, err := store.LoadJob(jobID)
+	if err != nil {
+		t.Fatalf("Failed to load pending job: %v", err)
+	}
+	aliceShare := approverShare(t, job, alice, alicePriv)
+
+	_, err = qs.Approve(jobID, newTestToken(jobID, "alice", DecisionApprove, "wrong-secret", aliceShare))
+	if err == nil {
+		t.Fatal("Expected approval with the wrong secret to fail, but it succeeded")
+	}
+}
+
+// TestResolveJobRequiresRealApproverShares guards against regressing to
+// a server that can reconstruct a job's key from config it already
+// holds: even with a full quorum of correctly authenticated approvals,
+// if the submitted shares aren't the real ones sealed to those
+// approvers, the job must not resolve.
+func TestResolveJobRequiresRealApproverShares(t *testing.T) {
+	store, err := NewJournalStore(filepath.Join(t.TempDir(), "quorum.journal"))
+	if err != nil {
+		t.Fatalf("Failed to create journal store: %v", err)
+	}
+	underlying := &recordingSigner{id: "normankey"}
+	alice, _ := testApprover(t, "alice", "alice-secret")
+	bob, _ := testApprover(t, "bob", "bob-secret")
+	policy := Policy{
+		MinApprovals:  2,
+		ApproverGroup: []Approver{alice, bob},
+	}
+	qs, err := New(underlying, policy, store)
+	if err != nil {
+		t.Fatalf("Failed to build quorum signer: %v", err)
+	}
+
+	sig, err := qs.SignData([]byte("please sign this release"), nil)
+	if err != nil {
+		t.Fatalf("SignData failed: %v", err)
+	}
+	jobID, _ := sig.Marshal()
+
+	fakeShare := []byte("not a real shamir share!!!")
+	if _, err := qs.Approve(jobID, newTestToken(jobID, "alice", DecisionApprove, "alice-secret", fakeShare)); err != nil {
+		t.Fatalf("First approval failed: %v", err)
+	}
+	if _, err := qs.Approve(jobID, newTestToken(jobID, "bob", DecisionApprove, "bob-secret", fakeShare)); err == nil {
+		t.Fatal("Expected resolving the job from fabricated shares to fail")
+	}
+}
+
+// TestOptionsSurviveJournalReload guards against regressing to storing
+// PendingJob.Options as interface{}: once a job is reloaded from the
+// journal (simulating a service restart between SignData and Approve),
+// resolveJob must still hand the underlying signer the original
+// options, not the generic map[string]interface{} a plain interface{}
+// field would decode JSON into.
+func TestOptionsSurviveJournalReload(t *testing.T) {
+	type testOptions struct {
+		Foo string `json:"foo"`
+	}
+
+	journalPath := filepath.Join(t.TempDir(), "quorum.journal")
+	store, err := NewJournalStore(journalPath)
+	if err != nil {
+		t.Fatalf("Failed to create journal store: %v", err)
+	}
+	underlying := &recordingSigner{id: "normankey"}
+	alice, alicePriv := testApprover(t, "alice", "alice-secret")
+	bob, bobPriv := testApprover(t, "bob", "bob-secret")
+	policy := Policy{
+		MinApprovals:  2,
+		ApproverGroup: []Approver{alice, bob},
+	}
+	qs, err := New(underlying, policy, store)
+	if err != nil {
+		t.Fatalf("Failed to build quorum signer: %v", err)
+	}
+
+	sig, err := qs.SignData([]byte("data"), testOptions{Foo: "bar"})
+	if err != nil {
+		t.Fatalf("SignData failed: %v", err)
+	}
+	jobID, _ := sig.Marshal()
+
+	job, err := store.LoadJob(jobID)
+	if err != nil {
+		t.Fatalf("Failed to load pending job: %v", err)
+	}
+	aliceShare := approverShare(t, job, alice, alicePriv)
+	bobShare := approverShare(t, job, bob, bobPriv)
+
+	// Simulate a service restart: approve against a fresh Signer built
+	// from a new Store handle reading the same journal file.
+	reloadedStore, err := NewJournalStore(journalPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen journal store: %v", err)
+	}
+	qs2, err := New(underlying, policy, reloadedStore)
+	if err != nil {
+		t.Fatalf("Failed to rebuild quorum signer: %v", err)
+	}
+	if _, err := qs2.Approve(jobID, newTestToken(jobID, "alice", DecisionApprove, "alice-secret", aliceShare)); err != nil {
+		t.Fatalf("First approval failed: %v", err)
+	}
+	if _, err := qs2.Approve(jobID, newTestToken(jobID, "bob", DecisionApprove, "bob-secret", bobShare)); err != nil {
+		t.Fatalf("Second approval failed: %v", err)
+	}
+
+	raw, ok := underlying.receivedOptions.(json.RawMessage)
+	if !ok {
+		t.Fatalf("expected underlying signer to receive json.RawMessage options, got %T", underlying.receivedOptions)
+	}
+	var got testOptions
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("failed to decode received options: %v", err)
+	}
+	if got.Foo != "bar" {
+		t.Fatalf("received options = %+v, want Foo=%q", got, "bar")
+	}
+}
@@ -0,0 +1,176 @@
+package quorum
+
+import (
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+)
+
+// Split and Combine implement Shamir's Secret Sharing over GF(256),
+// the same construction redoctober and HashiCorp Vault's unseal keys
+// use: one random degree-(k-1) polynomial per byte of the secret, with
+// the secret byte as the constant term, evaluated at n distinct
+// x-coordinates to produce n shares, any k of which reconstruct the
+// secret via Lagrange interpolation at x=0.
+
+// gfExpTable and gfLogTable are the field's exponent/logarithm tables
+// for the generator 3 under the AES reduction polynomial (x^8+x^4+x^3+x+1,
+// 0x11b), letting multiplication and division be done as table lookups.
+var (
+	gfExpTable [255]byte
+	gfLogTable [256]byte
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExpTable[i] = x
+		gfLogTable[x] = byte(i)
+		x = gfMulNoTable(x, 3)
+	}
+}
+
+func gfMulNoTable(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		if b&1 != 0 {
+			p ^= a
+		}
+		hiBitSet := a & 0x80
+		a <<= 1
+		if hiBitSet != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	sum := int(gfLogTable[a]) + int(gfLogTable[b])
+	if sum >= 255 {
+		sum -= 255
+	}
+	return gfExpTable[sum]
+}
+
+func gfDiv(a, b byte) (byte, error) {
+	if b == 0 {
+		return 0, errors.New("quorum: division by zero in GF(256)")
+	}
+	if a == 0 {
+		return 0, nil
+	}
+	diff := int(gfLogTable[a]) - int(gfLogTable[b])
+	if diff < 0 {
+		diff += 255
+	}
+	return gfExpTable[diff], nil
+}
+
+// Split divides secret into n shares such that any k of them (and no
+// fewer) can reconstruct it via Combine. Each share is len(secret)+1
+// bytes: a one-byte x-coordinate in [1,n], followed by one y-coordinate
+// per byte of secret.
+func Split(secret []byte, n, k int) ([][]byte, error) {
+	if k < 1 || k > n {
+		return nil, errors.New("quorum: threshold must be between 1 and the number of shares")
+	}
+	if n < 1 || n > 255 {
+		return nil, errors.New("quorum: number of shares must be between 1 and 255")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("quorum: cannot split an empty secret")
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	coeffs := make([]byte, k-1)
+	for byteIdx, secretByte := range secret {
+		if _, err := rand.Read(coeffs); err != nil {
+			return nil, errors.Wrap(err, "quorum: failed to generate polynomial coefficients")
+		}
+		for i := 0; i < n; i++ {
+			shares[i][byteIdx+1] = evalPolynomial(secretByte, coeffs, byte(i+1))
+		}
+	}
+	return shares, nil
+}
+
+// evalPolynomial evaluates, at x, the polynomial with constant term
+// constant and higher-degree coefficients coeffs (lowest degree first),
+// via Horner's method.
+func evalPolynomial(constant byte, coeffs []byte, x byte) byte {
+	result := byte(0)
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		result = gfMul(result, x) ^ coeffs[i]
+	}
+	return gfMul(result, x) ^ constant
+}
+
+// Combine reconstructs the secret Split produced, from k or more of its
+// shares. Passing fewer shares than the original threshold silently
+// returns a wrong answer: the math gives no way to detect that case.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 1 {
+		return nil, errors.New("quorum: at least 1 share is required")
+	}
+	shareLen := len(shares[0])
+	if shareLen < 2 {
+		return nil, errors.New("quorum: malformed share")
+	}
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, s := range shares {
+		if len(s) != shareLen {
+			return nil, errors.New("quorum: all shares must be the same length")
+		}
+		if seen[s[0]] {
+			return nil, errors.New("quorum: duplicate share x-coordinate")
+		}
+		seen[s[0]] = true
+		xs[i] = s[0]
+	}
+
+	secret := make([]byte, shareLen-1)
+	ys := make([]byte, len(shares))
+	for byteIdx := 0; byteIdx < shareLen-1; byteIdx++ {
+		for i, s := range shares {
+			ys[i] = s[byteIdx+1]
+		}
+		b, err := lagrangeInterpolateAtZero(xs, ys)
+		if err != nil {
+			return nil, err
+		}
+		secret[byteIdx] = b
+	}
+	return secret, nil
+}
+
+func lagrangeInterpolateAtZero(xs, ys []byte) (byte, error) {
+	var result byte
+	for i := range xs {
+		num := byte(1)
+		den := byte(1)
+		for j := range xs {
+			if i == j {
+				continue
+			}
+			num = gfMul(num, xs[j])
+			den = gfMul(den, xs[i]^xs[j])
+		}
+		term, err := gfDiv(num, den)
+		if err != nil {
+			return 0, err
+		}
+		result ^= gfMul(ys[i], term)
+	}
+	return result, nil
+}
@@ -0,0 +1,34 @@
+package quorum
+
+import "testing"
+
+func TestSplitCombineRoundTrip(t *testing.T) {
+	secret := []byte("super secret job key material!!")
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Failed to split secret: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("Expected 5 shares, got %d", len(shares))
+	}
+
+	got, err := Combine(shares[1:4])
+	if err != nil {
+		t.Fatalf("Failed to combine shares: %v", err)
+	}
+	if string(got) != string(secret) {
+		t.Fatalf("Combine produced %q, expected %q", got, secret)
+	}
+}
+
+func TestCombineRejectsDuplicateShare(t *testing.T) {
+	secret := []byte("another secret")
+	shares, err := Split(secret, 3, 2)
+	if err != nil {
+		t.Fatalf("Failed to split secret: %v", err)
+	}
+	_, err = Combine([][]byte{shares[0], shares[0]})
+	if err == nil {
+		t.Fatal("Expected combining a share with itself to fail, but it succeeded")
+	}
+}
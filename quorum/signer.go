@@ -0,0 +1,219 @@
+// Package quorum adds a redoctober-style m-of-n approval layer in
+// front of a signer.Signer: signing requests against sensitive signers
+// (an embedded CA, the XPI add-on root, APK release keys) are held as
+// encrypted PendingJobs until a threshold of approvers from the
+// signer's Policy have approved, and only then forwarded to the
+// underlying signer.
+package quorum
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.mozilla.org/autograph/signer"
+)
+
+// Signer wraps an underlying signer.Signer with a two-person-rule
+// approval Policy, persisting pending jobs and approvals to a Store.
+// It implements signer.Signer itself, so it can be configured in place
+// of the signer it wraps.
+type Signer struct {
+	underlying signer.Signer
+	policy     Policy
+	store      Store
+}
+
+// New wraps underlying with policy, persisting pending jobs and
+// approvals to store.
+func New(underlying signer.Signer, policy Policy, store Store) (*Signer, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return &Signer{underlying: underlying, policy: policy, store: store}, nil
+}
+
+// Config returns the underlying signer's configuration unchanged.
+func (s *Signer) Config() signer.Configuration {
+	return s.underlying.Config()
+}
+
+// PendingSignature is returned by Signer.SignData in place of the
+// underlying signer's real signature: it carries the job ID a quorum of
+// approvers from s.policy.ApproverGroup must approve, via POSTs to
+// /quorum/approve/{jobid}, before the real signature is produced.
+type PendingSignature struct {
+	JobID string `json:"quorum_job_id"`
+}
+
+// Marshal satisfies signer.Signature, serializing to the job ID alone
+// so callers know what to poll or wait for.
+func (p PendingSignature) Marshal() (string, error) {
+	return p.JobID, nil
+}
+
+// SignData never signs immediately. It encrypts input into a PendingJob
+// under a random key split via Shamir's Secret Sharing across
+// s.policy's approver group (options are stored alongside it as plain,
+// unencrypted JSON), persists the job to s.store, and
+// returns a PendingSignature referencing it. Signer.Approve produces the
+// real signature once enough approvals are collected.
+func (s *Signer) SignData(input []byte, options interface{}) (signer.Signature, error) {
+	job, err := s.newPendingJob(input, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.SaveJob(job); err != nil {
+		return nil, errors.Wrap(err, "quorum: failed to persist pending job")
+	}
+	return PendingSignature{JobID: job.ID}, nil
+}
+
+func (s *Signer) newPendingJob(input []byte, options interface{}) (*PendingJob, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrap(err, "quorum: failed to generate job key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "quorum: failed to generate job nonce")
+	}
+	ciphertext := gcm.Seal(nil, nonce, input, nil)
+
+	shares, err := Split(key, len(s.policy.ApproverGroup), s.policy.MinApprovals)
+	if err != nil {
+		return nil, errors.Wrap(err, "quorum: failed to split job key")
+	}
+	encShares := make(map[string]encryptedShare, len(shares))
+	for i, approver := range s.policy.ApproverGroup {
+		es, err := encryptShare(approver.SharePublicKey, shares[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "quorum: failed to encrypt share for approver %q", approver.ID)
+		}
+		encShares[approver.ID] = es
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	encodedOptions, err := json.Marshal(options)
+	if err != nil {
+		return nil, errors.Wrap(err, "quorum: failed to encode options")
+	}
+	return &PendingJob{
+		ID:              id,
+		SignerID:        s.underlying.Config().ID,
+		Ciphertext:      ciphertext,
+		Nonce:           nonce,
+		Options:         encodedOptions,
+		EncryptedShares: encShares,
+		Status:          JobPending,
+		CreatedAt:       time.Now(),
+	}, nil
+}
+
+// Approve records an approval or denial by the approver token
+// authenticates on the job identified by jobID. Once s.policy's
+// approval threshold has been met, it reconstructs the job's key,
+// decrypts the original request, forwards it to the underlying signer,
+// and persists the resulting signature.
+func (s *Signer) Approve(jobID string, token ApprovalToken) (*PendingJob, error) {
+	job, err := s.store.LoadJob(jobID)
+	if err != nil {
+		return nil, errors.Wrap(err, "quorum: failed to load job")
+	}
+	if job.Status != JobPending {
+		return job, errors.Errorf("quorum: job %s is no longer pending (status=%s)", jobID, job.Status)
+	}
+
+	approverID, err := s.authenticate(jobID, token)
+	if err != nil {
+		return nil, errors.Wrap(err, "quorum: approval authentication failed")
+	}
+	for _, a := range job.Approvals {
+		if a.ApproverID == approverID {
+			return nil, errors.Errorf("quorum: %q has already recorded a decision on job %s", approverID, jobID)
+		}
+	}
+	if token.Decision == DecisionApprove && len(token.Share) == 0 {
+		return nil, errors.New("quorum: an approval must include the approver's decrypted share")
+	}
+
+	approval := Approval{ApproverID: approverID, Decision: token.Decision, Timestamp: time.Now(), Share: token.Share}
+	job.Approvals = append(job.Approvals, approval)
+	auditApproval(job.ID, approval)
+
+	if token.Decision == DecisionDeny {
+		job.Status = JobDenied
+		auditResolved(job)
+		return job, s.store.SaveJob(job)
+	}
+
+	if approvalCount(job, DecisionApprove) < s.policy.MinApprovals {
+		return job, s.store.SaveJob(job)
+	}
+
+	if err := s.resolveJob(job); err != nil {
+		return job, err
+	}
+	return job, s.store.SaveJob(job)
+}
+
+// resolveJob reconstructs job's key from the shares approvers submitted
+// on their approving ApprovalTokens, decrypts the original request,
+// forwards it to the underlying signer, and records the resulting
+// signature on job. Unlike the rest of this package, it never touches
+// job.EncryptedShares: those are sealed to each approver's own private
+// key (see Approver.SharePublicKey), which the server doesn't have, so
+// the only shares it can ever combine are the ones approvers chose to
+// hand back themselves.
+func (s *Signer) resolveJob(job *PendingJob) error {
+	var shares [][]byte
+	for _, a := range job.Approvals {
+		if a.Decision != DecisionApprove {
+			continue
+		}
+		shares = append(shares, a.Share)
+	}
+	key, err := Combine(shares)
+	if err != nil {
+		return errors.Wrap(err, "quorum: failed to reconstruct job key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	input, err := gcm.Open(nil, job.Nonce, job.Ciphertext, nil)
+	if err != nil {
+		return errors.Wrap(err, "quorum: failed to decrypt pending job, reconstructed key is wrong")
+	}
+	sig, err := s.underlying.SignData(input, job.Options)
+	if err != nil {
+		return errors.Wrap(err, "quorum: underlying signer rejected the approved request")
+	}
+	marshaled, err := sig.Marshal()
+	if err != nil {
+		return err
+	}
+	job.Signature = marshaled
+	job.Status = JobApproved
+	auditResolved(job)
+	return nil
+}
@@ -0,0 +1,90 @@
+package quorum
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Store persists PendingJobs so a service restart doesn't lose
+// in-flight approvals.
+type Store interface {
+	SaveJob(job *PendingJob) error
+	LoadJob(id string) (*PendingJob, error)
+}
+
+// JournalStore is an append-only, on-disk Store: every SaveJob call
+// (job creation, or an approval updating it) appends the job's full
+// current state as one JSON line, and LoadJob replays the journal to
+// find the latest entry for an ID. Simple and crash-safe at the cost of
+// unbounded growth; operators running this long-term should rotate the
+// file the way they would any other append-only audit log.
+type JournalStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewJournalStore opens (creating if necessary) the journal file at
+// path for a JournalStore.
+func NewJournalStore(path string) (*JournalStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "quorum: failed to open journal %q", path)
+	}
+	f.Close()
+	return &JournalStore{path: path}, nil
+}
+
+// SaveJob appends job's current state to the journal.
+func (s *JournalStore) SaveJob(job *PendingJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "quorum: failed to open journal %q", s.path)
+	}
+	defer f.Close()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return errors.Wrap(err, "quorum: failed to serialize job")
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return errors.Wrapf(err, "quorum: failed to append to journal %q", s.path)
+	}
+	return nil
+}
+
+// LoadJob replays the journal and returns the most recent entry for id.
+func (s *JournalStore) LoadJob(id string) (*PendingJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "quorum: failed to open journal %q", s.path)
+	}
+	defer f.Close()
+
+	var latest *PendingJob
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var job PendingJob
+		if err := json.Unmarshal(scanner.Bytes(), &job); err != nil {
+			continue
+		}
+		if job.ID == id {
+			j := job
+			latest = &j
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "quorum: failed to read journal")
+	}
+	if latest == nil {
+		return nil, errors.Errorf("quorum: no job found with id %q", id)
+	}
+	return latest, nil
+}
@@ -24,6 +24,11 @@ type APKSigner struct {
 	signer.Configuration
 	signingKey  crypto.PrivateKey
 	signingCert *x509.Certificate
+	// lineage is the signer's rotation history, used to let v3 APKs
+	// signed with signingKey be accepted as an upgrade of APKs signed
+	// with an older key. It is nil when the configuration doesn't set
+	// a lineage, which is the common case for a signer on its first key.
+	lineage *Lineage
 }
 
 // New initializes an apk signer using a configuration
@@ -58,6 +63,17 @@ func New(conf signer.Configuration) (s *APKSigner, err error) {
 	if time.Now().Before(s.signingCert.NotBefore) || time.Now().After(s.signingCert.NotAfter) {
 		return nil, errors.New("apk: signer certificate is not currently valid")
 	}
+	if conf.Lineage != "" {
+		s.Lineage = conf.Lineage
+		lineageBytes, err := base64.StdEncoding.DecodeString(conf.Lineage)
+		if err != nil {
+			return nil, errors.Wrap(err, "apk: failed to decode lineage base64")
+		}
+		s.lineage, err = LoadLineage(lineageBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "apk: failed to parse signer lineage")
+		}
+	}
 	return
 }
 
@@ -68,11 +84,19 @@ func (s *APKSigner) Config() signer.Configuration {
 		Type:        s.Type,
 		PrivateKey:  s.PrivateKey,
 		Certificate: s.Certificate,
+		Lineage:     s.Lineage,
 	}
 }
 
 // SignData takes input data and returns a PKCS7 detached signature
 func (s *APKSigner) SignData(input []byte, options interface{}) (signer.Signature, error) {
+	// New only checks signingCert's validity once, at construction
+	// time; a long-running signer can outlive it, so re-check here
+	// rather than hand out a signature verifiers will reject.
+	now := time.Now()
+	if now.Before(s.signingCert.NotBefore) || now.After(s.signingCert.NotAfter) {
+		return nil, errors.Errorf("apk: signer %q certificate is not valid at %s (notBefore=%s, notAfter=%s), refusing to sign", s.ID, now, s.signingCert.NotBefore, s.signingCert.NotAfter)
+	}
 	p7sig := new(Signature)
 	toBeSigned, err := pkcs7.NewSignedData(input)
 	if err != nil {
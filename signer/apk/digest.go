@@ -0,0 +1,47 @@
+package apk
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// chunkSize is the 1 MiB chunk size mandated by the v2/v3 signature scheme
+const chunkSize = 1024 * 1024
+
+// chunkedSHA256Digest implements the chunked content digest used by the
+// APK Signature Scheme v2/v3: the content is split into 1 MiB chunks,
+// each chunk is hashed as SHA-256(0xa5 || uint32-le(chunk length) ||
+// chunk), and the final digest is SHA-256(0x5a || uint32-le(chunk
+// count) || concat(chunk digests)).
+func chunkedSHA256Digest(regions ...[]byte) []byte {
+	var chunkDigests [][]byte
+	for _, region := range regions {
+		for len(region) > 0 {
+			n := chunkSize
+			if n > len(region) {
+				n = len(region)
+			}
+			chunkDigests = append(chunkDigests, hashChunk(region[:n]))
+			region = region[n:]
+		}
+	}
+	h := sha256.New()
+	h.Write([]byte{0x5a})
+	var countBuf [4]byte
+	binary.LittleEndian.PutUint32(countBuf[:], uint32(len(chunkDigests)))
+	h.Write(countBuf[:])
+	for _, d := range chunkDigests {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func hashChunk(chunk []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0xa5})
+	var lenBuf [4]byte
+	binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(chunk)))
+	h.Write(lenBuf[:])
+	h.Write(chunk)
+	return h.Sum(nil)
+}
@@ -0,0 +1,364 @@
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mozilla.org/pkcs7"
+)
+
+const (
+	manifestPath = "META-INF/MANIFEST.MF"
+	sigFilePath  = "META-INF/CERT.SF"
+	rsaCertPath  = "META-INF/CERT.RSA"
+	ecCertPath   = "META-INF/CERT.EC"
+)
+
+// SignJAR takes an unsigned APK (or any ZIP), and returns a fully signed
+// v1 (JAR-style) APK: a META-INF/MANIFEST.MF listing a digest of every
+// entry, a META-INF/CERT.SF listing a digest of every section of the
+// manifest, and a META-INF/CERT.RSA (or .EC, depending on the signer's
+// key type) holding a PKCS7 detached signature over CERT.SF. This moves
+// the META-INF assembly that every autograph client used to have to do
+// itself into the signer.
+func (s *APKSigner) SignJAR(input []byte, options interface{}) ([]byte, error) {
+	opts, err := optionsFrom(options)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: invalid signing options")
+	}
+	opts = opts.withDefaults()
+
+	zr, err := zip.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: failed to read input as a zip archive")
+	}
+
+	entries, err := readEntries(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, sections := buildManifest(entries, opts.DigestAlgorithm)
+	sigFile := buildSignatureFile(manifest, sections, opts.DigestAlgorithm)
+
+	pkcs7Sig, err := s.signCertSF(sigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return writeSignedJAR(entries, manifest, sigFile, pkcs7Sig, s.signingKey)
+}
+
+// jarEntry is one non-directory, non-META-INF file extracted from the
+// input archive. readEntries returns them sorted by name, so the output
+// APK's entry ordering is by name rather than the input's order.
+type jarEntry struct {
+	name string
+	data []byte
+}
+
+func readEntries(zr *zip.Reader) ([]jarEntry, error) {
+	var entries []jarEntry
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "META-INF/") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, errors.Wrapf(err, "apk: failed to open zip entry %q", f.Name)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "apk: failed to read zip entry %q", f.Name)
+		}
+		entries = append(entries, jarEntry{name: f.Name, data: data})
+	}
+	// Entry order in the manifest doesn't matter for verification, but a
+	// stable, sorted order keeps signed output reproducible across runs.
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
+
+// buildManifest returns the full MANIFEST.MF and, for each entry, the
+// raw bytes of its own "Name: ...\r\n<alg>-Digest: ...\r\n\r\n" section,
+// which CERT.SF needs to digest individually.
+func buildManifest(entries []jarEntry, alg DigestAlgorithm) (manifest []byte, sections map[string][]byte) {
+	var buf bytes.Buffer
+	buf.WriteString("Manifest-Version: 1.0\r\n\r\n")
+
+	sections = make(map[string][]byte, len(entries))
+	for _, e := range entries {
+		section := []byte(fmt.Sprintf("Name: %s\r\n%s-Digest: %s\r\n\r\n",
+			e.name, alg, digestBase64(alg, e.data)))
+		sections[e.name] = section
+		buf.Write(section)
+	}
+	return buf.Bytes(), sections
+}
+
+// buildSignatureFile returns CERT.SF: a digest of the whole manifest,
+// followed by a per-entry digest of that entry's manifest section.
+func buildSignatureFile(manifest []byte, sections map[string][]byte, alg DigestAlgorithm) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Signature-Version: 1.0\r\n%s-Digest-Manifest: %s\r\n\r\n",
+		alg, digestBase64(alg, manifest))
+
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "Name: %s\r\n%s-Digest: %s\r\n\r\n",
+			name, alg, digestBase64(alg, sections[name]))
+	}
+	return buf.Bytes()
+}
+
+func digestBase64(alg DigestAlgorithm, data []byte) string {
+	var sum []byte
+	if alg == DigestSHA1 {
+		d := sha1.Sum(data)
+		sum = d[:]
+	} else {
+		d := sha256.Sum256(data)
+		sum = d[:]
+	}
+	return base64.StdEncoding.EncodeToString(sum)
+}
+
+// signCertSF produces a detached PKCS7 signature over CERT.SF using the
+// signer's configured key and certificate, the same mechanism SignData
+// already uses for the legacy signing path.
+func (s *APKSigner) signCertSF(sigFile []byte) ([]byte, error) {
+	toBeSigned, err := pkcs7.NewSignedData(sigFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: cannot initialize CERT.SF signed data")
+	}
+	if err := toBeSigned.AddSigner(s.signingCert, s.signingKey, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, errors.Wrap(err, "apk: cannot sign CERT.SF")
+	}
+	toBeSigned.Detach()
+	sig, err := toBeSigned.Finish()
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: cannot finish CERT.SF signature")
+	}
+	return sig, nil
+}
+
+// writeSignedJAR assembles the final APK: the original entries, followed
+// by META-INF/MANIFEST.MF, META-INF/CERT.SF and META-INF/CERT.{RSA,EC}.
+func writeSignedJAR(entries []jarEntry, manifest, sigFile, pkcs7Sig []byte, key crypto.PrivateKey) ([]byte, error) {
+	var out bytes.Buffer
+	zw := zip.NewWriter(&out)
+
+	write := func(name string, data []byte) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return errors.Wrapf(err, "apk: failed to create zip entry %q", name)
+		}
+		_, err = io.Copy(w, bytes.NewReader(data))
+		return errors.Wrapf(err, "apk: failed to write zip entry %q", name)
+	}
+
+	for _, e := range entries {
+		if err := write(e.name, e.data); err != nil {
+			return nil, err
+		}
+	}
+
+	certPath := rsaCertPath
+	if _, isEC := key.(*ecdsa.PrivateKey); isEC {
+		certPath = ecCertPath
+	}
+
+	if err := write(manifestPath, manifest); err != nil {
+		return nil, err
+	}
+	if err := write(sigFilePath, sigFile); err != nil {
+		return nil, err
+	}
+	if err := write(certPath, pkcs7Sig); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, errors.Wrap(err, "apk: failed to finalize signed zip archive")
+	}
+	return out.Bytes(), nil
+}
+
+// verifyJAR checks the legacy v1 (JAR-style) signature of apkBytes: it
+// parses the PKCS7 detached signature in META-INF/CERT.{RSA,EC},
+// verifies it signs META-INF/CERT.SF, and then verifies CERT.SF's
+// manifest digest and per-entry digests all the way down to the actual
+// bytes of every non-META-INF entry in the archive. This is the inverse
+// of SignJAR.
+func verifyJAR(apkBytes []byte, roots *x509.CertPool) (bool, []*x509.Certificate, error) {
+	zr, err := zip.NewReader(bytes.NewReader(apkBytes), int64(len(apkBytes)))
+	if err != nil {
+		return false, nil, errors.Wrap(err, "apk: failed to read zip for v1 verification")
+	}
+
+	files := make(map[string][]byte, len(zr.File))
+	var entryNames []string
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return false, nil, errors.Wrapf(err, "apk: failed to open zip entry %q", f.Name)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return false, nil, errors.Wrapf(err, "apk: failed to read zip entry %q", f.Name)
+		}
+		files[f.Name] = data
+		if !strings.HasPrefix(f.Name, "META-INF/") {
+			entryNames = append(entryNames, f.Name)
+		}
+	}
+
+	manifest, ok := files[manifestPath]
+	if !ok {
+		return false, nil, errors.New("apk: no v1 signature available: missing META-INF/MANIFEST.MF")
+	}
+	sigFile, ok := files[sigFilePath]
+	if !ok {
+		return false, nil, errors.New("apk: no v1 signature available: missing META-INF/CERT.SF")
+	}
+	pkcs7Sig, ok := files[rsaCertPath]
+	if !ok {
+		if pkcs7Sig, ok = files[ecCertPath]; !ok {
+			return false, nil, errors.New("apk: no v1 signature available: missing META-INF/CERT.RSA or CERT.EC")
+		}
+	}
+
+	p7, err := pkcs7.Parse(pkcs7Sig)
+	if err != nil {
+		return false, nil, errors.Wrap(err, "apk: failed to parse v1 PKCS7 signature")
+	}
+	// The signature is detached (Detach was called in signCertSF), so
+	// the content it signs over has to be supplied back explicitly.
+	p7.Content = sigFile
+	if err := p7.VerifyWithChain(roots); err != nil {
+		return false, nil, errors.Wrap(err, "apk: v1 PKCS7 signature did not verify")
+	}
+
+	sfGlobal, sfNamed, err := manifestBlocks(sigFile)
+	if err != nil {
+		return false, nil, errors.Wrap(err, "apk: failed to parse CERT.SF")
+	}
+	manifestAlg, wantManifestDigest, err := findDigestHeader(sfGlobal, "-Digest-Manifest")
+	if err != nil {
+		return false, nil, errors.Wrap(err, "apk: CERT.SF is missing a manifest digest")
+	}
+	if digestBase64(manifestAlg, manifest) != wantManifestDigest {
+		return false, nil, errors.New("apk: CERT.SF's manifest digest does not match META-INF/MANIFEST.MF")
+	}
+
+	_, mfNamed, err := manifestBlocks(manifest)
+	if err != nil {
+		return false, nil, errors.Wrap(err, "apk: failed to parse MANIFEST.MF")
+	}
+	if len(mfNamed) != len(entryNames) {
+		return false, nil, errors.New("apk: MANIFEST.MF does not cover exactly the archive's entries")
+	}
+	for _, name := range entryNames {
+		mfBlock, ok := mfNamed[name]
+		if !ok {
+			return false, nil, errors.Errorf("apk: entry %q is not listed in MANIFEST.MF", name)
+		}
+		entryAlg, wantEntryDigest, err := findDigestHeader(mfBlock, "-Digest")
+		if err != nil {
+			return false, nil, errors.Wrapf(err, "apk: MANIFEST.MF entry %q is missing a digest", name)
+		}
+		if digestBase64(entryAlg, files[name]) != wantEntryDigest {
+			return false, nil, errors.Errorf("apk: entry %q does not match its MANIFEST.MF digest", name)
+		}
+
+		sfBlock, ok := sfNamed[name]
+		if !ok {
+			return false, nil, errors.Errorf("apk: entry %q is not listed in CERT.SF", name)
+		}
+		sfAlg, wantSectionDigest, err := findDigestHeader(sfBlock, "-Digest")
+		if err != nil {
+			return false, nil, errors.Wrapf(err, "apk: CERT.SF entry %q is missing a digest", name)
+		}
+		if digestBase64(sfAlg, mfBlock) != wantSectionDigest {
+			return false, nil, errors.Errorf("apk: CERT.SF's digest for entry %q does not match its MANIFEST.MF section", name)
+		}
+	}
+
+	return true, p7.Certificates, nil
+}
+
+// manifestBlocks splits a MANIFEST.MF- or CERT.SF-formatted file into
+// its leading global block and its "Name: ..." per-entry blocks, keyed
+// by entry name. Each block keeps the exact bytes buildManifest and
+// buildSignatureFile produced (including the trailing blank line),
+// since that's what their digests were computed over.
+func manifestBlocks(data []byte) (global []byte, named map[string][]byte, err error) {
+	named = make(map[string][]byte)
+	for len(data) > 0 {
+		idx := bytes.Index(data, []byte("\r\n\r\n"))
+		if idx < 0 {
+			return nil, nil, errors.New("apk: truncated manifest section")
+		}
+		block := data[:idx+4]
+		data = data[idx+4:]
+		name := blockHeader(block, "Name")
+		if name == "" {
+			if global != nil {
+				return nil, nil, errors.New("apk: more than one unnamed manifest section")
+			}
+			global = block
+			continue
+		}
+		named[name] = block
+	}
+	if global == nil {
+		return nil, nil, errors.New("apk: manifest has no global header section")
+	}
+	return global, named, nil
+}
+
+// blockHeader returns the value of the "key: value" header line in
+// block, or "" if key isn't present.
+func blockHeader(block []byte, key string) string {
+	prefix := []byte(key + ": ")
+	for _, line := range bytes.Split(block, []byte("\r\n")) {
+		if bytes.HasPrefix(line, prefix) {
+			return string(line[len(prefix):])
+		}
+	}
+	return ""
+}
+
+// findDigestHeader looks for a "<alg>"+suffix header (e.g.
+// "SHA-256-Digest-Manifest" or "SHA1-Digest") in block, trying every
+// DigestAlgorithm this package knows how to produce, and returns
+// whichever one is present along with its value.
+func findDigestHeader(block []byte, suffix string) (DigestAlgorithm, string, error) {
+	for _, alg := range []DigestAlgorithm{DigestSHA256, DigestSHA1} {
+		if v := blockHeader(block, string(alg)+suffix); v != "" {
+			return alg, v, nil
+		}
+	}
+	return "", "", errors.Errorf("apk: no recognized %q header", suffix)
+}
@@ -0,0 +1,187 @@
+package apk
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// lineageMagic identifies Android apksigner's on-disk lineage format
+const lineageMagic uint32 = 0x3eb6a12c
+
+// lineageVersion is the only lineage format version apksigner has shipped
+const lineageVersion uint32 = 1
+
+// proofOfRotationAttrID is the v3 additional-attribute ID under which the
+// signer lineage is embedded in the signed-data, so Android >= 9 can
+// accept a new signing key as a rotation of a previously trusted one
+const proofOfRotationAttrID uint32 = 0x3ba06f8c
+
+// Capabilities is a bitmask of privileges a lineage node's signing key
+// grants to its successors once Android treats it as a rotated identity.
+type Capabilities uint32
+
+const (
+	// CapInstalledData allows apps signed by a later key in the lineage
+	// to access data left behind by an app signed with this one
+	CapInstalledData Capabilities = 1 << iota
+	// CapSharedUID allows joining the same android:sharedUserId
+	CapSharedUID
+	// CapPermission allows granting signature-level permissions defined
+	// by an app signed with this key to one signed by a later key
+	CapPermission
+	// CapRollback allows rolling back from a later key to this one
+	CapRollback
+)
+
+// DefaultCapabilities grants every capability, which is what apksigner's
+// own `--lineage` tooling defaults to unless told otherwise.
+const DefaultCapabilities = CapInstalledData | CapSharedUID | CapPermission | CapRollback
+
+// LineageNode is one certificate in a signer's rotation history, plus the
+// capabilities its key grants to its successor(s).
+type LineageNode struct {
+	Cert         *x509.Certificate
+	Capabilities Capabilities
+	// Signature is the signature, by this node's key, over the next
+	// node's SubjectPublicKeyInfo plus its capabilities. It is empty for
+	// the last (current) node in the lineage.
+	Signature []byte
+	SigAlg    uint32
+}
+
+// Lineage is the ordered history of signing certificates for an APK,
+// oldest first, each one having signed off on its successor via a
+// proof-of-rotation record.
+type Lineage struct {
+	Nodes []LineageNode
+}
+
+// AppendLineage extends lineage with a new signing certificate. lineage
+// must already hold at least its first node: a nil or empty lineage is
+// rejected with an error. It produces the proof-of-rotation
+// record that has oldKey (the current last node's key) sign newCert's
+// public key and the capabilities granted to it.
+func AppendLineage(lineage *Lineage, oldKey crypto.PrivateKey, newCert *x509.Certificate, caps Capabilities) (*Lineage, error) {
+	if lineage == nil {
+		lineage = &Lineage{}
+	}
+	if len(lineage.Nodes) == 0 {
+		return nil, errors.New("apk: cannot append to an empty lineage without a first (self-signed) node; add it directly")
+	}
+	spki, err := x509.MarshalPKIXPublicKey(newCert.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: failed to marshal successor public key")
+	}
+	toBeSigned := append(lengthPrefixedBytes(spki), uint32LE(uint32(caps))...)
+
+	sig, err := signWithKey(oldKey, toBeSigned)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: failed to sign successor's lineage entry")
+	}
+
+	last := &lineage.Nodes[len(lineage.Nodes)-1]
+	last.Signature = sig
+	last.SigAlg = sigAlgFor(oldKey)
+
+	lineage.Nodes = append(lineage.Nodes, LineageNode{Cert: newCert, Capabilities: caps})
+	return lineage, nil
+}
+
+func signWithKey(key crypto.PrivateKey, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return k.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	default:
+		return nil, errors.Errorf("apk: unsupported lineage signing key type %T", key)
+	}
+}
+
+// DumpLineage serializes a lineage to Android apksigner's on-disk
+// format: a magic, a version, and then each node as (SPKI, flags,
+// signature-algorithm, signature-over-successor).
+func DumpLineage(lineage *Lineage) ([]byte, error) {
+	var buf bytes.Buffer
+	writeUint32LE(&buf, lineageMagic)
+	writeUint32LE(&buf, lineageVersion)
+	for _, node := range lineage.Nodes {
+		spki, err := x509.MarshalPKIXPublicKey(node.Cert.PublicKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "apk: failed to marshal lineage node public key")
+		}
+		buf.Write(lengthPrefixedBytes(spki))
+		writeUint32LE(&buf, uint32(node.Capabilities))
+		writeUint32LE(&buf, node.SigAlg)
+		buf.Write(lengthPrefixedBytes(node.Signature))
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadLineage parses a lineage previously serialized by DumpLineage (or
+// by Android's own apksigner --lineage tooling).
+func LoadLineage(data []byte) (*Lineage, error) {
+	if len(data) < 8 {
+		return nil, errors.New("apk: lineage data too short")
+	}
+	if binary.LittleEndian.Uint32(data[:4]) != lineageMagic {
+		return nil, errors.New("apk: not a valid apksigner lineage (bad magic)")
+	}
+	data = data[8:] // skip magic + version
+	var lineage Lineage
+	for len(data) > 0 {
+		spki, rest, err := takeUint32Prefixed(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "apk: truncated lineage node public key")
+		}
+		if len(rest) < 8 {
+			return nil, errors.New("apk: truncated lineage node flags/algorithm")
+		}
+		caps := binary.LittleEndian.Uint32(rest[:4])
+		sigAlg := binary.LittleEndian.Uint32(rest[4:8])
+		sig, rest, err := takeUint32Prefixed(rest[8:])
+		if err != nil {
+			return nil, errors.Wrap(err, "apk: truncated lineage node signature")
+		}
+		pub, err := x509.ParsePKIXPublicKey(spki)
+		if err != nil {
+			return nil, errors.Wrap(err, "apk: failed to parse lineage node public key")
+		}
+		lineage.Nodes = append(lineage.Nodes, LineageNode{
+			Cert:         &x509.Certificate{PublicKey: pub},
+			Capabilities: Capabilities(caps),
+			Signature:    sig,
+			SigAlg:       sigAlg,
+		})
+		data = rest
+	}
+	return &lineage, nil
+}
+
+// lineageAttribute returns the lineage, wrapped as a v3 additional
+// attribute, ready to be concatenated with any other attributes and
+// passed as extraAttrs to buildSignedData.
+func (s *APKSigner) lineageAttribute() ([]byte, error) {
+	if s.lineage == nil {
+		return nil, nil
+	}
+	dumped, err := DumpLineage(s.lineage)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: failed to serialize signer lineage")
+	}
+	attr := append(uint32LE(proofOfRotationAttrID), dumped...)
+	return lengthPrefixedBytes(attr), nil
+}
+
+func writeUint32LE(buf *bytes.Buffer, v uint32) {
+	buf.Write(uint32LE(v))
+}
@@ -0,0 +1,63 @@
+package apk
+
+// Scheme identifies one of the APK signing schemes understood by
+// SignFile. Schemes are additive: V2 implies V1 is also produced, and
+// V3 implies both V1 and V2 are also produced, because older Android
+// releases only know how to verify the older schemes.
+type Scheme uint8
+
+const (
+	// SchemeV1V2V3 produces v1, v2 and v3 signatures. It is the zero
+	// value of Scheme, so a request that omits "scheme" gets the
+	// broadest, most current signature coverage rather than the
+	// weakest one.
+	SchemeV1V2V3 Scheme = iota
+	// SchemeV1V2 produces a v1 signature plus a v2 APK Signing Block
+	SchemeV1V2
+	// SchemeV1 produces a legacy JAR (META-INF/*) signature only
+	SchemeV1
+)
+
+// DigestAlgorithm selects the hash used to digest each ZIP entry when
+// building the v1 JAR manifest.
+type DigestAlgorithm string
+
+const (
+	// DigestSHA256 is the default, modern digest algorithm for v1 manifests
+	DigestSHA256 DigestAlgorithm = "SHA-256"
+	// DigestSHA1 is kept for compatibility with very old Android releases
+	// that do not understand SHA-256 manifest digests
+	DigestSHA1 DigestAlgorithm = "SHA1"
+)
+
+// Options configure a single call to APKSigner.SignFile. They are
+// typically decoded from the "options" field of a signing request.
+type Options struct {
+	// Scheme selects which combination of v1/v2/v3 signatures to emit.
+	// The zero value is SchemeV1V2V3, so omitting this field signs
+	// with the broadest scheme coverage rather than the narrowest.
+	Scheme Scheme `json:"scheme"`
+
+	// MinSdkVersion and MaxSdkVersion bound the v3 signer's applicable
+	// platform range. They are only meaningful when Scheme is
+	// SchemeV1V2V3 and are ignored otherwise.
+	MinSdkVersion int `json:"min_sdk_version,omitempty"`
+	MaxSdkVersion int `json:"max_sdk_version,omitempty"`
+
+	// DigestAlgorithm selects the manifest digest used when SignFile
+	// builds the v1 META-INF/MANIFEST.MF and CERT.SF. Defaults to
+	// DigestSHA256.
+	DigestAlgorithm DigestAlgorithm `json:"digest_algorithm,omitempty"`
+}
+
+// withDefaults returns a copy of o with zero-valued fields replaced by
+// their defaults.
+func (o Options) withDefaults() Options {
+	if o.MaxSdkVersion == 0 {
+		o.MaxSdkVersion = int(^uint32(0) >> 1) // Android's Integer.MAX_VALUE
+	}
+	if o.DigestAlgorithm == "" {
+		o.DigestAlgorithm = DigestSHA256
+	}
+	return o
+}
@@ -0,0 +1,380 @@
+package apk
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"go.mozilla.org/autograph/signer"
+)
+
+const (
+	// v2BlockID is the ID of a v2 signature scheme block inside the APK Signing Block
+	v2BlockID uint32 = 0x7109871a
+	// v3BlockID is the ID of a v3 signature scheme block inside the APK Signing Block
+	v3BlockID uint32 = 0xf05368c0
+
+	// apkSigningBlockMagic is the 16 byte magic that terminates an APK Signing Block
+	apkSigningBlockMagic = "APK Sig Block 42"
+
+	// blockAlignment is the multiple, in bytes, that the APK Signing
+	// Block's total size is padded to
+	blockAlignment = 4096
+
+	sigAlgECDSAWithSHA256    uint32 = 0x0201
+	sigAlgRSAPKCS1WithSHA256 uint32 = 0x0103
+
+	// paddingBlockID is the ID-value pair ID apksigner uses to pad the
+	// APK Signing Block out to a 4096-byte boundary
+	paddingBlockID uint32 = 0x42726577
+
+	// stripProtectionAttrID is the additional-attribute ID a v2 block
+	// carries to declare that a newer scheme block (identified by its
+	// block ID as the attribute's value) must also be present,
+	// preventing an attacker from stripping it off the file
+	stripProtectionAttrID uint32 = 0xbeeff00d
+)
+
+// stripProtectionAttribute returns the additional-attributes sequence
+// declaring that blockID must also be present in the APK Signing Block,
+// ready to be passed as extraAttrs to buildSignedData.
+func stripProtectionAttribute(blockID uint32) []byte {
+	attr := append(uint32LE(stripProtectionAttrID), uint32LE(blockID)...)
+	return lengthPrefixedBytes(attr)
+}
+
+// FileSignature wraps the fully signed APK produced by SignFile so
+// APKSigner satisfies signer.SignFiler. Unlike Signature, it has
+// nothing to detach from the input: the "signature" is the complete,
+// already-assembled file.
+type FileSignature struct {
+	File []byte
+}
+
+// Marshal returns the base64 representation of the fully signed APK.
+func (sig *FileSignature) Marshal() (string, error) {
+	if len(sig.File) == 0 {
+		return "", errors.New("apk: cannot marshal empty signed file")
+	}
+	return base64.StdEncoding.EncodeToString(sig.File), nil
+}
+
+// SignFile signs an entire unsigned APK using the scheme(s) selected by
+// options.Scheme and returns the fully signed APK, replacing the
+// per-client assembly of META-INF/* and hand-rolled v2/v3 blocks with a
+// single signer-side call. It always produces the v1 (JAR) signature via
+// SignJAR, since every higher scheme is additive on top of it; when
+// Scheme is SchemeV1V2 or SchemeV1V2V3 it then builds an APK Signing
+// Block covering the v2 (and v3) signatures and splices it into the ZIP
+// between the last local file entry and the Central Directory.
+func (s *APKSigner) SignFile(input []byte, options interface{}) (signer.Signature, error) {
+	opts, err := optionsFrom(options)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: invalid signing options")
+	}
+	opts = opts.withDefaults()
+
+	v1Signed, err := s.SignJAR(input, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: failed to produce v1 signature")
+	}
+	if opts.Scheme == SchemeV1 {
+		return &FileSignature{File: v1Signed}, nil
+	}
+
+	layout, err := parseZipLayout(v1Signed)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: failed to parse zip layout")
+	}
+
+	// The signing block's contents digest the EOCD record, but the EOCD
+	// record itself has to carry the Central Directory offset shifted
+	// by the block we're about to splice in -- and that offset isn't
+	// known until the block exists. Build it once over the
+	// as-yet-unpatched EOCD purely to learn its length (fixed by the
+	// digest and signature sizes, not by which EOCD bytes it covers),
+	// then build the real, shipped block over the correctly patched
+	// EOCD.
+	placeholderIDValues, err := s.buildIDValuePairs(layout, layout.eocd, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: failed to build signing block contents")
+	}
+	placeholderBlock := buildSigningBlock(placeholderIDValues)
+
+	newCDOffset := uint32(len(layout.beforeCD) + len(placeholderBlock))
+	patchedEOCDRecord := patchedEOCD(layout.eocd, newCDOffset)
+
+	idValues, err := s.buildIDValuePairs(layout, patchedEOCDRecord, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: failed to build signing block contents")
+	}
+	block := buildSigningBlock(idValues)
+	if len(block) != len(placeholderBlock) {
+		return nil, errors.New("apk: signing block size changed after patching the EOCD offset, central directory offset would be invalid")
+	}
+
+	var out bytes.Buffer
+	out.Write(layout.beforeCD)
+	out.Write(block)
+	out.Write(layout.cd)
+	out.Write(patchedEOCDRecord)
+	return &FileSignature{File: out.Bytes()}, nil
+}
+
+// optionsFrom decodes the signing request's options into an
+// apk.Options, treating a nil or zero-value options field as "use the
+// defaults". Besides an already-typed Options value, it also accepts
+// json.RawMessage (and the map[string]interface{} plain encoding/json
+// produces from it), since a caller that round-trips options through
+// JSON -- a pending quorum job reloaded from its journal, for instance
+// -- can no longer hand back the original Go type.
+func optionsFrom(options interface{}) (Options, error) {
+	switch v := options.(type) {
+	case nil:
+		return Options{}, nil
+	case Options:
+		return v, nil
+	case *Options:
+		return *v, nil
+	case json.RawMessage:
+		return decodeOptions(v)
+	case map[string]interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return Options{}, errors.Wrap(err, "apk: failed to re-encode options")
+		}
+		return decodeOptions(data)
+	default:
+		return Options{}, errors.Errorf("apk: unsupported options type %T", options)
+	}
+}
+
+func decodeOptions(data []byte) (Options, error) {
+	var opts Options
+	if len(data) == 0 || string(data) == "null" {
+		return opts, nil
+	}
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return Options{}, errors.Wrap(err, "apk: failed to decode options")
+	}
+	return opts, nil
+}
+
+// buildIDValuePairs computes the v2 (and, if requested, v3) blocks that
+// make up the contents of the APK Signing Block. eocd is the EOCD
+// record that will actually ship in the signed file, which the caller
+// is responsible for patching with the post-splice Central Directory
+// offset before the final (non-placeholder) call.
+func (s *APKSigner) buildIDValuePairs(layout *zipLayout, eocd []byte, opts Options) ([]idValue, error) {
+	digest := chunkedSHA256Digest(layout.beforeCD, layout.cd, eocd)
+
+	// When a v3 block will also be present, the v2 signed-data carries a
+	// stripping-protection attribute naming it, so a verifier that sees
+	// the v2 block alone knows a v3 block was stripped off and refuses
+	// to accept the downgrade (see hasStrippingProtectionAttribute).
+	var v2ExtraAttrs []byte
+	if opts.Scheme == SchemeV1V2V3 {
+		v2ExtraAttrs = stripProtectionAttribute(v3BlockID)
+	}
+	v2SignedData, err := s.buildSignedData(digest, v2ExtraAttrs)
+	if err != nil {
+		return nil, err
+	}
+	v2Entry, err := s.buildSignerEntry(v2SignedData, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: failed to build v2 signer entry")
+	}
+	pairs := []idValue{{id: v2BlockID, value: wrapSigners(v2Entry)}}
+
+	if opts.Scheme == SchemeV1V2V3 {
+		lineageAttr, err := s.lineageAttribute()
+		if err != nil {
+			return nil, err
+		}
+		v3SignedData, err := s.buildSignedData(digest, lineageAttr)
+		if err != nil {
+			return nil, err
+		}
+		sdkVersions := append(uint32LE(uint32(opts.MinSdkVersion)), uint32LE(uint32(opts.MaxSdkVersion))...)
+		v3Entry, err := s.buildSignerEntry(v3SignedData, sdkVersions)
+		if err != nil {
+			return nil, errors.Wrap(err, "apk: failed to build v3 signer entry")
+		}
+		pairs = append(pairs, idValue{id: v3BlockID, value: wrapSigners(v3Entry)})
+	}
+	return pairs, nil
+}
+
+// signedData is the "signed-data" structure of a v2/v3 signer: a
+// length-prefixed sequence of digests, certificates and additional
+// attributes, all of which get covered by the signature itself.
+type signedData struct {
+	digests    []byte
+	certs      []byte
+	attributes []byte
+}
+
+func (s *APKSigner) buildSignedData(digest []byte, extraAttrs []byte) (*signedData, error) {
+	digestEntry := append(uint32LE(sigAlgFor(s.signingKey)), lengthPrefixedBytes(digest)...)
+	return &signedData{
+		digests:    lengthPrefixed(lengthPrefixedBytes(digestEntry)),
+		certs:      lengthPrefixed(lengthPrefixedBytes(s.signingCert.Raw)),
+		attributes: lengthPrefixed(extraAttrs),
+	}, nil
+}
+
+// buildSignerEntry assembles one "signer" entry of a v2/v3 block:
+// length-prefixed signed-data, optionally followed by the v3
+// minSdkVersion/maxSdkVersion pair (sdkVersions is nil for v2, which
+// has no such fields), then the signature and public key.
+func (s *APKSigner) buildSignerEntry(sd *signedData, sdkVersions []byte) ([]byte, error) {
+	signedDataBytes := append(append([]byte{}, sd.digests...), sd.certs...)
+	signedDataBytes = append(signedDataBytes, sd.attributes...)
+
+	sig, err := s.signBytes(signedDataBytes)
+	if err != nil {
+		return nil, err
+	}
+	sigEntry := append(uint32LE(sigAlgFor(s.signingKey)), lengthPrefixedBytes(sig)...)
+
+	spki, err := x509.MarshalPKIXPublicKey(publicKeyFor(s.signingKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: failed to marshal signer public key")
+	}
+
+	var entry bytes.Buffer
+	entry.Write(lengthPrefixedBytes(signedDataBytes))
+	entry.Write(sdkVersions)
+	entry.Write(lengthPrefixedBytes(sigEntry))
+	entry.Write(lengthPrefixedBytes(spki))
+	return entry.Bytes(), nil
+}
+
+// wrapSigners wraps a single signer entry into the bytes an ID-value
+// pair's "value" holds for a v2/v3 block: a length-prefixed sequence of
+// length-prefixed signer entries. This signer only ever emits one
+// signer entry per block.
+func wrapSigners(entry []byte) []byte {
+	return lengthPrefixedBytes(lengthPrefixedBytes(entry))
+}
+
+// idValue is one (ID, length-prefixed value) pair stored in the APK
+// Signing Block.
+type idValue struct {
+	id    uint32
+	value []byte
+}
+
+// buildSigningBlock assembles the APK Signing Block from its ID-value
+// pairs, padding the result so its total size is a multiple of 4096
+// bytes. Only the size is padded: the block starts wherever the
+// preceding ZIP entries end, so its start offset is not aligned.
+func buildSigningBlock(pairs []idValue) []byte {
+	var body bytes.Buffer
+	for _, p := range pairs {
+		entry := append(uint32LE(p.id), p.value...)
+		body.Write(lengthPrefixedBytes(entry))
+	}
+
+	// size-of-block (repeated at start and end) + 16 byte magic, not
+	// counted in the size field itself per the spec.
+	blockSize := uint64(8 + body.Len() + 16)
+	var block bytes.Buffer
+	writeUint64LE(&block, blockSize)
+	block.Write(body.Bytes())
+	writeUint64LE(&block, blockSize)
+	block.Write([]byte(apkSigningBlockMagic))
+
+	if pad := alignmentPadding(block.Len()); pad > 0 {
+		// A padding ID-value pair costs 8 bytes of framing (4 byte
+		// length prefix + 4 byte ID) on top of its value, so round up
+		// to the next alignment boundary when the gap is too small to
+		// hold that framing.
+		for pad < 8 {
+			pad += blockAlignment
+		}
+		paddingValue := make([]byte, pad-8)
+		paddingEntry := append(uint32LE(paddingBlockID), paddingValue...)
+		body.Write(lengthPrefixedBytes(paddingEntry))
+		blockSize = uint64(8 + body.Len() + 16)
+		block.Reset()
+		writeUint64LE(&block, blockSize)
+		block.Write(body.Bytes())
+		writeUint64LE(&block, blockSize)
+		block.Write([]byte(apkSigningBlockMagic))
+	}
+	return block.Bytes()
+}
+
+func alignmentPadding(size int) int {
+	rem := size % blockAlignment
+	if rem == 0 {
+		return 0
+	}
+	return blockAlignment - rem
+}
+
+func sigAlgFor(key crypto.PrivateKey) uint32 {
+	switch key.(type) {
+	case *ecdsa.PrivateKey:
+		return sigAlgECDSAWithSHA256
+	default:
+		return sigAlgRSAPKCS1WithSHA256
+	}
+}
+
+func publicKeyFor(key crypto.PrivateKey) crypto.PublicKey {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return &k.PublicKey
+	case *rsa.PrivateKey:
+		return &k.PublicKey
+	default:
+		return nil
+	}
+}
+
+func (s *APKSigner) signBytes(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	switch key := s.signingKey.(type) {
+	case *ecdsa.PrivateKey:
+		return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	default:
+		return nil, errors.Errorf("apk: unsupported private key type %T", key)
+	}
+}
+
+func uint32LE(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func writeUint64LE(buf *bytes.Buffer, v uint64) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	buf.Write(b)
+}
+
+// lengthPrefixedBytes prefixes data with its own uint32 length, the
+// encoding used throughout the APK Signing Block format.
+func lengthPrefixedBytes(data []byte) []byte {
+	return append(uint32LE(uint32(len(data))), data...)
+}
+
+// lengthPrefixed is an alias of lengthPrefixedBytes kept for readability
+// at call sites that are themselves building up a length-prefixed
+// sequence of length-prefixed values.
+func lengthPrefixed(data []byte) []byte {
+	return lengthPrefixedBytes(data)
+}
@@ -0,0 +1,233 @@
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	"go.mozilla.org/autograph/signer"
+)
+
+// newTestSigner builds an APKSigner backed by a fresh, self-signed
+// ECDSA certificate, and returns it alongside a pool trusting that
+// certificate as a root, so tests can round-trip through Verify.
+func newTestSigner(t *testing.T) (*APKSigner, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "apk signingblock test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	s, err := New(signer.Configuration{
+		Type:        Type,
+		ID:          "apktest",
+		PrivateKey:  string(keyPEM),
+		Certificate: string(certPEM),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return s, roots
+}
+
+// unsignedTestAPK returns a minimal, valid ZIP archive with one entry,
+// standing in for an unsigned APK.
+func unsignedTestAPK(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("classes.dex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("not really a dex file, just test content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSignFileRoundTripsThroughVerify(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"v1":     {Scheme: SchemeV1},
+		"v1v2":   {Scheme: SchemeV1V2},
+		"v1v2v3": {Scheme: SchemeV1V2V3},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, roots := newTestSigner(t)
+			unsigned := unsignedTestAPK(t)
+
+			sig, err := s.SignFile(unsigned, opts)
+			if err != nil {
+				t.Fatalf("SignFile failed: %v", err)
+			}
+			fileSig, ok := sig.(*FileSignature)
+			if !ok {
+				t.Fatalf("expected *FileSignature, got %T", sig)
+			}
+
+			if opts.Scheme == SchemeV1 {
+				// The v1-only path doesn't produce a parseable APK
+				// Signing Block, so Verify falls all the way back
+				// to the JAR signature.
+				if _, err := zip.NewReader(bytes.NewReader(fileSig.File), int64(len(fileSig.File))); err != nil {
+					t.Fatalf("v1-signed output is not a valid zip: %v", err)
+				}
+				result, err := Verify(fileSig.File, roots)
+				if err != nil {
+					t.Fatalf("Verify failed: %v", err)
+				}
+				if !result.V1Verified {
+					t.Fatal("expected V1Verified to be true")
+				}
+				return
+			}
+
+			result, err := Verify(fileSig.File, roots)
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if !result.V1Verified {
+				t.Fatal("expected V1Verified to be true")
+			}
+			if !result.V2Verified {
+				t.Fatal("expected V2Verified to be true")
+			}
+			if opts.Scheme == SchemeV1V2V3 && !result.V3Verified {
+				t.Fatal("expected V3Verified to be true")
+			}
+		})
+	}
+}
+
+// TestSignFileDigestsThePatchedEOCD guards against regressing to
+// digesting the zip's original, unpatched EOCD record (which carries
+// the pre-splice Central Directory offset): if that ever happens again,
+// Verify will recompute the digest over the patched EOCD actually
+// shipped in the file and fail to match the embedded signature.
+func TestSignFileDigestsThePatchedEOCD(t *testing.T) {
+	s, roots := newTestSigner(t)
+	unsigned := unsignedTestAPK(t)
+
+	sig, err := s.SignFile(unsigned, Options{Scheme: SchemeV1V2})
+	if err != nil {
+		t.Fatalf("SignFile failed: %v", err)
+	}
+	fileSig := sig.(*FileSignature)
+
+	layout, err := parseZipLayout(fileSig.File)
+	if err != nil {
+		t.Fatalf("failed to parse signed output's zip layout: %v", err)
+	}
+	if _, _, _, err := findSigningBlock(fileSig.File, layout); err != nil {
+		t.Fatalf("failed to locate the spliced-in APK Signing Block: %v", err)
+	}
+
+	if _, err := Verify(fileSig.File, roots); err != nil {
+		t.Fatalf("Verify failed on a freshly signed file: %v", err)
+	}
+}
+
+// TestVerifyV1RejectsTamperedEntry guards against regressing to a
+// verifyV1 that only checks the PKCS7 signature over CERT.SF without
+// walking its digests down to MANIFEST.MF and the actual entry bytes:
+// an attacker who swaps a signed entry for different content, without
+// touching META-INF/*, must still get caught.
+func TestVerifyV1RejectsTamperedEntry(t *testing.T) {
+	s, roots := newTestSigner(t)
+	unsigned := unsignedTestAPK(t)
+
+	sig, err := s.SignFile(unsigned, Options{Scheme: SchemeV1})
+	if err != nil {
+		t.Fatalf("SignFile failed: %v", err)
+	}
+	fileSig := sig.(*FileSignature)
+
+	zr, err := zip.NewReader(bytes.NewReader(fileSig.File), int64(len(fileSig.File)))
+	if err != nil {
+		t.Fatalf("failed to read signed output as a zip: %v", err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Name == "classes.dex" {
+			if _, err := w.Write([]byte("tampered content, different length")); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(w, rc); err != nil {
+			t.Fatal(err)
+		}
+		rc.Close()
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(buf.Bytes(), roots); err == nil {
+		t.Fatal("expected Verify to reject a v1-signed APK with a tampered entry")
+	}
+}
+
+func TestFileSignatureMarshal(t *testing.T) {
+	sig := &FileSignature{File: []byte("signed apk bytes")}
+	out, err := sig.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out == "" {
+		t.Fatal("expected a non-empty base64 string")
+	}
+
+	empty := &FileSignature{}
+	if _, err := empty.Marshal(); err == nil {
+		t.Fatal("expected an error marshalling an empty file signature")
+	}
+}
@@ -0,0 +1,381 @@
+package apk
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// ErrMixedDexApkFile is returned by Verify when the input begins with a
+// DEX file magic even though the trailing ZIP/APK verifies correctly.
+// This is the "Janus" attack (CVE-2017-13156): a DEX payload is
+// prepended to a validly v1/v2/v3-signed APK, and because the Dalvik/ART
+// class loader scans for a DEX header before falling back to the APK's
+// classes.dex, the device executes the prepended (unsigned, attacker
+// controlled) code while the package manager verifies the untouched,
+// legitimately signed APK.
+var ErrMixedDexApkFile = errors.New("apk: input starts with a DEX header; refusing a Janus-style DEX/APK polyglot")
+
+// dexMagicPrefix is the fixed "dex\n" prefix shared by every DEX file
+// format version (035, 036, 037, 038, 039, ...); the following 3 digits
+// and NUL byte encode the version and are not checked.
+var dexMagicPrefix = []byte("dex\n")
+
+// VerificationResult reports which signature schemes were present and
+// valid in an APK, along with the certificate chain each one verified
+// against.
+type VerificationResult struct {
+	V1Verified bool
+	V2Verified bool
+	V3Verified bool
+
+	V1Chain []*x509.Certificate
+	V2Chain []*x509.Certificate
+	V3Chain []*x509.Certificate
+}
+
+// Verify checks the v1 (JAR), v2 and v3 signatures of apkBytes against
+// roots and returns which schemes verified and their certificate chains.
+// It refuses to consider the file valid at all if it looks like a
+// DEX/APK polyglot (see ErrMixedDexApkFile), and enforces the scheme
+// downgrade protections of the v2/v3 spec: a v2 or v3 block that is
+// present must itself verify (an older scheme is not accepted in its
+// place), and when a v3 block is present a v2 block, if there is one,
+// must carry a stripping-protection attribute naming it. The v1 signature is only
+// required when no APK Signing Block is present.
+func Verify(apkBytes []byte, roots *x509.CertPool) (*VerificationResult, error) {
+	if len(apkBytes) >= 4 && bytes.Equal(apkBytes[:4], dexMagicPrefix) {
+		return nil, ErrMixedDexApkFile
+	}
+
+	layout, err := parseZipLayout(apkBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: failed to parse zip layout")
+	}
+
+	v1Verified, v1Chain, v1Err := verifyV1(apkBytes, roots)
+
+	block, blockStart, hasBlock, err := findSigningBlock(apkBytes, layout)
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: failed to parse APK Signing Block")
+	}
+
+	result := &VerificationResult{
+		V1Verified: v1Verified,
+		V1Chain:    v1Chain,
+	}
+	if !hasBlock {
+		if !v1Verified {
+			return nil, errors.Wrap(v1Err, "apk: no v2/v3 block present and v1 signature did not verify")
+		}
+		return result, nil
+	}
+
+	// The v2/v3 digest covers the ZIP entries that precede the APK
+	// Signing Block, not layout.beforeCD: in the final, signed file the
+	// block itself sits inside that range, between the last entry and
+	// the Central Directory.
+	digest := chunkedSHA256Digest(apkBytes[:blockStart], layout.cd, layout.eocd)
+
+	if v2Value, ok := block[v2BlockID]; ok {
+		verified, chain, err := verifySignerBlock(v2Value, digest, roots, false)
+		if err != nil {
+			return nil, errors.Wrap(err, "apk: v2 signature verification failed")
+		}
+		result.V2Verified = verified
+		result.V2Chain = chain
+		// Downgrade protection: a v2 block is present, so a v1-only
+		// signature is not an acceptable fallback for this file.
+		if !verified {
+			return nil, errors.New("apk: v2 block is present but did not verify; refusing the v1 fallback")
+		}
+	}
+
+	if v3Value, ok := block[v3BlockID]; ok {
+		verified, chain, err := verifySignerBlock(v3Value, digest, roots, true)
+		if err != nil {
+			return nil, errors.Wrap(err, "apk: v3 signature verification failed")
+		}
+		result.V3Verified = verified
+		result.V3Chain = chain
+		if !verified {
+			return nil, errors.New("apk: v3 block is present but did not verify; refusing the v1/v2 fallback")
+		}
+		// Downgrade protection: if a v3 block exists, the v2 block (if
+		// any) must carry the stripping-protection attribute pointing
+		// at it, so an attacker can't strip the v3 block and have v2
+		// silently accepted instead.
+		if v2Value, ok := block[v2BlockID]; ok {
+			if !hasStrippingProtectionAttribute(v2Value, v3BlockID) {
+				return nil, errors.New("apk: v3 block present without a matching stripping-protection attribute in the v2 block")
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// verifyV1 checks the legacy v1 (JAR) signature: the PKCS7 signature in
+// META-INF/CERT.{RSA,EC} over META-INF/CERT.SF, and CERT.SF's digests
+// down to META-INF/MANIFEST.MF and every other entry in the archive.
+// See verifyJAR. It does not fail Verify outright, since a v2/v3-only
+// APK is legitimate; callers fall back to it only when no v2/v3 block
+// is present.
+func verifyV1(apkBytes []byte, roots *x509.CertPool) (bool, []*x509.Certificate, error) {
+	return verifyJAR(apkBytes, roots)
+}
+
+// findSigningBlock locates the APK Signing Block immediately preceding
+// the Central Directory (per layout) and returns its ID-value pairs
+// along with the offset, within apkBytes, that the block starts at.
+func findSigningBlock(apkBytes []byte, layout *zipLayout) (pairs map[uint32][]byte, blockStart int, hasBlock bool, err error) {
+	cdOffset := len(layout.beforeCD)
+	if cdOffset < 24 || !bytes.HasSuffix(apkBytes[:cdOffset], []byte(apkSigningBlockMagic)) {
+		return nil, 0, false, nil
+	}
+	sizeFieldOffset := cdOffset - 16 - 8
+	if sizeFieldOffset < 8 {
+		return nil, 0, false, errors.New("apk: truncated APK Signing Block")
+	}
+	blockSize := binary.LittleEndian.Uint64(apkBytes[sizeFieldOffset : sizeFieldOffset+8])
+	blockStart = cdOffset - 8 - int(blockSize)
+	if blockStart < 0 {
+		return nil, 0, false, errors.New("apk: APK Signing Block size field out of range")
+	}
+	leadingSize := binary.LittleEndian.Uint64(apkBytes[blockStart : blockStart+8])
+	if leadingSize != blockSize {
+		return nil, 0, false, errors.New("apk: APK Signing Block leading and trailing size fields disagree")
+	}
+
+	pairs = make(map[uint32][]byte)
+	body := apkBytes[blockStart+8 : sizeFieldOffset]
+	for len(body) > 0 {
+		if len(body) < 4 {
+			return nil, 0, false, errors.New("apk: truncated ID-value pair")
+		}
+		entryLen := binary.LittleEndian.Uint32(body[:4])
+		body = body[4:]
+		if uint64(len(body)) < uint64(entryLen) || entryLen < 4 {
+			return nil, 0, false, errors.New("apk: truncated ID-value pair entry")
+		}
+		id := binary.LittleEndian.Uint32(body[:4])
+		pairs[id] = body[4:entryLen]
+		body = body[entryLen:]
+	}
+	return pairs, blockStart, true, nil
+}
+
+// verifySignerBlock parses a v2 or v3 signer-entry sequence, checks that
+// at least one signer's signature over the recomputed content digest is
+// valid, and builds the certificate chain for it.
+func verifySignerBlock(value []byte, contentDigest []byte, roots *x509.CertPool, isV3 bool) (bool, []*x509.Certificate, error) {
+	signers, err := readLengthPrefixed(value)
+	if err != nil {
+		return false, nil, err
+	}
+	for len(signers) > 0 {
+		entryLen, rest, err := takeUint32Prefixed(signers)
+		if err != nil {
+			return false, nil, err
+		}
+		signer := entryLen
+		signers = rest
+
+		signedDataBytes, remainder, err := takeUint32Prefixed(signer)
+		if err != nil {
+			return false, nil, err
+		}
+		if isV3 {
+			// skip minSdkVersion/maxSdkVersion
+			if len(remainder) < 8 {
+				return false, nil, errors.New("apk: truncated v3 signer entry")
+			}
+			remainder = remainder[8:]
+		}
+		sigSeq, remainder, err := takeUint32Prefixed(remainder)
+		if err != nil {
+			return false, nil, err
+		}
+		pubKeyDER, _, err := takeUint32Prefixed(remainder)
+		if err != nil {
+			return false, nil, err
+		}
+
+		digests, certs, err := parseSignedData(signedDataBytes)
+		if err != nil {
+			return false, nil, err
+		}
+		if !bytes.Equal(digests, contentDigest) {
+			continue
+		}
+
+		chain, err := certChainFrom(certs, roots)
+		if err != nil {
+			continue
+		}
+
+		if verifyAnySignature(signedDataBytes, sigSeq, pubKeyDER) {
+			return true, chain, nil
+		}
+	}
+	return false, nil, nil
+}
+
+func verifyAnySignature(signedData, sigSeq, pubKeyDER []byte) bool {
+	pub, err := x509.ParsePKIXPublicKey(pubKeyDER)
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256(signedData)
+	for len(sigSeq) > 0 {
+		algID := binary.LittleEndian.Uint32(sigSeq[:4])
+		sig, rest, err := takeUint32Prefixed(sigSeq[4:])
+		if err != nil {
+			return false
+		}
+		sigSeq = rest
+		switch key := pub.(type) {
+		case *ecdsa.PublicKey:
+			if algID == sigAlgECDSAWithSHA256 && ecdsa.VerifyASN1(key, digest[:], sig) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if algID == sigAlgRSAPKCS1WithSHA256 && rsa.VerifyPKCS1v15(key, 0, digest[:], sig) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseSignedData extracts the content digest and certificate chain out
+// of a v2/v3 signed-data structure.
+func parseSignedData(signedData []byte) (digest []byte, certs [][]byte, err error) {
+	digestSeq, rest, err := takeUint32Prefixed(signedData)
+	if err != nil {
+		return nil, nil, err
+	}
+	certSeq, _, err := takeUint32Prefixed(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	for len(digestSeq) > 0 {
+		entryLen, remainder, err := takeUint32Prefixed(digestSeq)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(entryLen) < 4 {
+			return nil, nil, errors.New("apk: truncated digest entry")
+		}
+		d, _, err := takeUint32Prefixed(entryLen[4:])
+		if err != nil {
+			return nil, nil, err
+		}
+		digest = d
+		digestSeq = remainder
+	}
+	for len(certSeq) > 0 {
+		cert, remainder, err := takeUint32Prefixed(certSeq)
+		if err != nil {
+			return nil, nil, err
+		}
+		certs = append(certs, cert)
+		certSeq = remainder
+	}
+	return digest, certs, nil
+}
+
+func certChainFrom(certDERs [][]byte, roots *x509.CertPool) ([]*x509.Certificate, error) {
+	if len(certDERs) == 0 {
+		return nil, errors.New("apk: signer entry carries no certificates")
+	}
+	var chain []*x509.Certificate
+	for _, der := range certDERs {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.Wrap(err, "apk: failed to parse signer certificate")
+		}
+		chain = append(chain, cert)
+	}
+	if roots == nil {
+		return chain, nil
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{Roots: roots})
+	if err != nil {
+		return nil, errors.Wrap(err, "apk: certificate chain did not verify against trusted roots")
+	}
+	return chain, nil
+}
+
+// hasStrippingProtectionAttribute reports whether any signer in the v2
+// block's signed-data additional-attributes carries an attribute
+// declaring that expectedBlockID must also be present, which is how the
+// v2/v3 spec prevents stripping the newer block off a file.
+func hasStrippingProtectionAttribute(v2Value []byte, expectedBlockID uint32) bool {
+	signers, err := readLengthPrefixed(v2Value)
+	if err != nil {
+		return false
+	}
+	for len(signers) > 0 {
+		entry, rest, err := takeUint32Prefixed(signers)
+		if err != nil {
+			return false
+		}
+		signers = rest
+		signedDataBytes, _, err := takeUint32Prefixed(entry)
+		if err != nil {
+			return false
+		}
+		_, certSeq, err := takeUint32Prefixed(signedDataBytes)
+		if err != nil {
+			return false
+		}
+		_, attrSeqField, err := takeUint32Prefixed(certSeq)
+		if err != nil {
+			continue
+		}
+		attrSeq, _, err := takeUint32Prefixed(attrSeqField)
+		if err != nil {
+			continue
+		}
+		for len(attrSeq) > 0 {
+			attr, remainder, err := takeUint32Prefixed(attrSeq)
+			if err != nil {
+				break
+			}
+			if len(attr) >= 4 && binary.LittleEndian.Uint32(attr[:4]) == stripProtectionAttrID {
+				if len(attr) >= 8 && binary.LittleEndian.Uint32(attr[4:8]) == expectedBlockID {
+					return true
+				}
+			}
+			attrSeq = remainder
+		}
+	}
+	return false
+}
+
+// readLengthPrefixed strips the outer uint32 length prefix from a
+// length-prefixed blob and returns its contents.
+func readLengthPrefixed(data []byte) ([]byte, error) {
+	v, _, err := takeUint32Prefixed(data)
+	return v, err
+}
+
+// takeUint32Prefixed reads a uint32-length-prefixed value off the front
+// of data and returns (value, remainder).
+func takeUint32Prefixed(data []byte) (value []byte, remainder []byte, err error) {
+	if len(data) < 4 {
+		return nil, nil, errors.New("apk: truncated length-prefixed field")
+	}
+	n := binary.LittleEndian.Uint32(data[:4])
+	data = data[4:]
+	if uint64(len(data)) < uint64(n) {
+		return nil, nil, errors.New("apk: length-prefixed field overruns buffer")
+	}
+	return data[:n], data[n:], nil
+}
@@ -0,0 +1,75 @@
+package apk
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	eocdMagic    = 0x06054b50
+	eocdMinSize  = 22
+	eocdMaxSize  = eocdMinSize + 0xffff // comment can be up to 65535 bytes
+	cdOffsetOff  = 16                   // offset of the CD-offset field within the EOCD record
+	cdOffsetSize = 4
+)
+
+// zipLayout describes the three regions of a ZIP/APK file that the v2/v3
+// signing schemes digest separately: everything before the Central
+// Directory, the Central Directory itself, and the End Of Central
+// Directory record. eocd holds the record as found in the file; the
+// signer digests and writes out a copy whose CD-offset field patchedEOCD
+// has rewritten
+// to account for the APK Signing Block that gets spliced in between.
+type zipLayout struct {
+	beforeCD []byte
+	cd       []byte
+	eocd     []byte
+}
+
+// parseZipLayout locates the EOCD record of a ZIP file and splits the
+// file into the three regions signed by the v2/v3 schemes. It does not
+// support the Zip64 EOCD extension, which real-world APKs do not use.
+func parseZipLayout(apk []byte) (*zipLayout, error) {
+	eocdOffset, err := findEOCD(apk)
+	if err != nil {
+		return nil, err
+	}
+	eocd := apk[eocdOffset:]
+	cdOffset := binary.LittleEndian.Uint32(eocd[cdOffsetOff : cdOffsetOff+cdOffsetSize])
+	if int(cdOffset) > eocdOffset {
+		return nil, errors.New("apk: central directory offset points past end of central directory record")
+	}
+	return &zipLayout{
+		beforeCD: apk[:cdOffset],
+		cd:       apk[cdOffset:eocdOffset],
+		eocd:     eocd,
+	}, nil
+}
+
+// findEOCD scans backward from the end of the file for the End Of
+// Central Directory signature, the way every zip reader has to since
+// the archive comment has a variable length.
+func findEOCD(apk []byte) (int, error) {
+	maxBack := eocdMaxSize
+	if maxBack > len(apk) {
+		maxBack = len(apk)
+	}
+	start := len(apk) - maxBack
+	for i := len(apk) - eocdMinSize; i >= start; i-- {
+		if binary.LittleEndian.Uint32(apk[i:i+4]) == eocdMagic {
+			return i, nil
+		}
+	}
+	return 0, errors.New("apk: could not find End Of Central Directory record")
+}
+
+// patchedEOCD returns a copy of the EOCD record with its CD-offset field
+// rewritten to newCDOffset, so it keeps pointing at the Central
+// Directory after an APK Signing Block has been inserted before it.
+func patchedEOCD(eocd []byte, newCDOffset uint32) []byte {
+	patched := make([]byte, len(eocd))
+	copy(patched, eocd)
+	binary.LittleEndian.PutUint32(patched[cdOffsetOff:cdOffsetOff+cdOffsetSize], newCDOffset)
+	return patched
+}
@@ -0,0 +1,77 @@
+// Package signer provides the interfaces and data types shared by all
+// of the signer implementations configured in autograph (contentsignature,
+// xpi, apk, gpg2, etc).
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// Configuration defines the parameters used to configure and initialize a signer
+type Configuration struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	PrivateKey  string `json:"privatekey,omitempty"`
+	PublicKey   string `json:"publickey,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
+
+	// Lineage is an apk-signer-specific, base64-encoded history of
+	// previous signing certificates (Android apksigner's on-disk
+	// lineage format), used to rotate an APK's signing key while
+	// keeping older installs upgradeable. See signer/apk.LoadLineage.
+	Lineage string `json:"lineage,omitempty"`
+}
+
+// Signature is satisfied by the output of every signer's SignData method.
+// Implementations know how to serialize themselves back to the client.
+type Signature interface {
+	Marshal() (string, error)
+}
+
+// Signer is implemented by every autograph signer and exposes its
+// configuration along with the detached-signature signing path.
+type Signer interface {
+	Config() Configuration
+	SignData(input []byte, options interface{}) (Signature, error)
+}
+
+// SignFiler is an optional interface implemented by signers that operate
+// on an entire file format (as opposed to an opaque blob of bytes) and
+// return the whole signed file rather than a detached signature. The apk
+// signer implements this to produce fully signed APKs via SignFile, and
+// handlers that expose a file-signing endpoint should type-assert a
+// configured signer against SignFiler before invoking it.
+type SignFiler interface {
+	SignFile(input []byte, options interface{}) (Signature, error)
+}
+
+// ParsePrivateKey takes a PEM block and tries to decode an RSA or ECDSA
+// private key out of it, trying PKCS1, EC and PKCS8 forms in turn.
+func ParsePrivateKey(keyPEM []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("signer: failed to parse private key PEM")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "signer: failed to parse private key")
+	}
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return key, nil
+	default:
+		return nil, errors.New("signer: unsupported private key type")
+	}
+}
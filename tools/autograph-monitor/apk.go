@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+	"go.mozilla.org/autograph/signer"
+	"go.mozilla.org/autograph/signer/apk"
+)
+
+// selfTestAPK parses the apk signature the apk signer under test just
+// produced, the same way a real Android installer would, instead of
+// trusting the signer's own "Finished" bit. It mirrors the contract of
+// verifyContentSignature: a returned error means the signer is
+// misbehaving and should page someone.
+func selfTestAPK(signedAPK []byte, roots *x509.CertPool) error {
+	result, err := apk.Verify(signedAPK, roots)
+	if errors.Cause(err) == apk.ErrMixedDexApkFile {
+		return errors.Wrap(err, "apk self-test: produced file looks like a Janus DEX/APK polyglot")
+	}
+	if err != nil {
+		return errors.Wrap(err, "apk self-test: failed to verify signed apk")
+	}
+	if !result.V1Verified && !result.V2Verified && !result.V3Verified {
+		return errors.New("apk self-test: signed apk carries no verifiable signature scheme")
+	}
+	return nil
+}
+
+// selfTestAPKSigning drives s through the whole-file signing path via
+// signer.SignFiler, exactly as a handler that exposes apk signing would,
+// then runs the result through selfTestAPK. It exists so the apk
+// signer's SignFile wiring is exercised end to end rather than sitting
+// unused behind the SignFiler interface.
+func selfTestAPKSigning(s signer.SignFiler, unsignedAPK []byte, options interface{}, roots *x509.CertPool) error {
+	sig, err := s.SignFile(unsignedAPK, options)
+	if err != nil {
+		return errors.Wrap(err, "apk self-test: SignFile failed")
+	}
+	marshalled, err := sig.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "apk self-test: failed to marshal signed file")
+	}
+	signedAPK, err := base64.StdEncoding.DecodeString(marshalled)
+	if err != nil {
+		return errors.Wrap(err, "apk self-test: failed to decode signed file")
+	}
+	return selfTestAPK(signedAPK, roots)
+}
@@ -23,10 +23,16 @@ func TestVerifyContentSignature(t *testing.T) {
 		})
 		log.Fatal(http.ListenAndServe(":64320", nil))
 	}()
-	err := verifyContentSignature(ValidMonitoringContentSignature)
+	report, err := verifyContentSignature(ValidMonitoringContentSignature)
 	if err != nil {
 		t.Fatalf("Failed to verify monitoring content signature: %v", err)
 	}
+	if !report.SignatureVerified {
+		t.Fatal("Expected MonitoringReport.SignatureVerified to be true for a valid signature")
+	}
+	if report.ChainLength == 0 {
+		t.Fatal("Expected MonitoringReport.ChainLength to be populated")
+	}
 }
 
 func TestVerifyExpiredCertChain(t *testing.T) {
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// sctListExtensionOID is the X.509 extension OID under which a
+// certificate carries its embedded Signed Certificate Timestamps,
+// defined by RFC 6962 section 3.3.
+var sctListExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// CTLogConfig is one trusted CT log entry from conf.CTLogs: its log ID
+// (base64 SHA-256 of its public key, as logs advertise it) and the PEM
+// public key used to verify SCT signatures it issues.
+type CTLogConfig struct {
+	ID        string `yaml:"id"`
+	PublicKey string `yaml:"publickey"`
+}
+
+// signedCertificateTimestamp is one TLS-encoded SCT, per RFC 6962 section 3.2
+type signedCertificateTimestamp struct {
+	version       uint8
+	logID         [32]byte
+	timestamp     uint64
+	extensions    []byte
+	hashAlgorithm uint8
+	sigAlgorithm  uint8
+	signature     []byte
+}
+
+// parseSCTList decodes the TLS-encoded "SignedCertificateTimestampList"
+// carried in the sctListExtensionOID extension value (itself wrapped in
+// an OCTET STRING by the X.509 extension encoding, and then in another
+// OCTET STRING as the list's own TLS encoding).
+func parseSCTList(extnValue []byte) ([]signedCertificateTimestamp, error) {
+	var octet []byte
+	if _, err := asn1.Unmarshal(extnValue, &octet); err != nil {
+		return nil, errors.Wrap(err, "ct: failed to unwrap SCT list OCTET STRING")
+	}
+	if len(octet) < 2 {
+		return nil, errors.New("ct: truncated SCT list")
+	}
+	listLen := int(binary.BigEndian.Uint16(octet[:2]))
+	data := octet[2:]
+	if len(data) < listLen {
+		return nil, errors.New("ct: SCT list length exceeds available data")
+	}
+	data = data[:listLen]
+
+	var scts []signedCertificateTimestamp
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errors.New("ct: truncated SCT entry length")
+		}
+		entryLen := int(binary.BigEndian.Uint16(data[:2]))
+		data = data[2:]
+		if len(data) < entryLen {
+			return nil, errors.New("ct: truncated SCT entry")
+		}
+		sct, err := parseSCT(data[:entryLen])
+		if err != nil {
+			return nil, err
+		}
+		scts = append(scts, sct)
+		data = data[entryLen:]
+	}
+	return scts, nil
+}
+
+func parseSCT(data []byte) (signedCertificateTimestamp, error) {
+	var sct signedCertificateTimestamp
+	if len(data) < 1+32+8+2 {
+		return sct, errors.New("ct: truncated SCT")
+	}
+	sct.version = data[0]
+	copy(sct.logID[:], data[1:33])
+	sct.timestamp = binary.BigEndian.Uint64(data[33:41])
+	data = data[41:]
+
+	extLen := int(binary.BigEndian.Uint16(data[:2]))
+	data = data[2:]
+	if len(data) < extLen+4 {
+		return sct, errors.New("ct: truncated SCT extensions/signature")
+	}
+	sct.extensions = data[:extLen]
+	data = data[extLen:]
+
+	sct.hashAlgorithm = data[0]
+	sct.sigAlgorithm = data[1]
+	data = data[2:]
+
+	sigLen := int(binary.BigEndian.Uint16(data[:2]))
+	data = data[2:]
+	if len(data) < sigLen {
+		return sct, errors.New("ct: truncated SCT signature")
+	}
+	sct.signature = data[:sigLen]
+	return sct, nil
+}
+
+// merkleTreeLeaf builds the RFC 6962 section 3.4 MerkleTreeLeaf /
+// "signed_entry" structure an SCT's signature is computed over, for an
+// ordinary (non-precertificate) x509_entry.
+func merkleTreeLeaf(sct signedCertificateTimestamp, certDER []byte) []byte {
+	var buf []byte
+	buf = append(buf, 0) // sct version: v1
+	buf = append(buf, 0) // signature type: certificate_timestamp
+	ts := make([]byte, 8)
+	binary.BigEndian.PutUint64(ts, sct.timestamp)
+	buf = append(buf, ts...)
+	buf = append(buf, 0, 0) // log entry type: x509_entry
+	certLen := make([]byte, 3)
+	certLen[0] = byte(len(certDER) >> 16)
+	certLen[1] = byte(len(certDER) >> 8)
+	certLen[2] = byte(len(certDER))
+	buf = append(buf, certLen...)
+	buf = append(buf, certDER...)
+	extLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(extLen, uint16(len(sct.extensions)))
+	buf = append(buf, extLen...)
+	buf = append(buf, sct.extensions...)
+	return buf
+}
+
+// merkleTreeLeafPrecert builds the RFC 6962 section 3.4 MerkleTreeLeaf /
+// "signed_entry" structure an SCT's signature is computed over, for a
+// precert_entry: the SHA-256 hash of the issuing CA's public key,
+// followed by the precertificate's TBSCertificate.
+func merkleTreeLeafPrecert(sct signedCertificateTimestamp, issuerKeyHash [32]byte, precertTBS []byte) []byte {
+	var buf []byte
+	buf = append(buf, 0) // sct version: v1
+	buf = append(buf, 0) // signature type: certificate_timestamp
+	ts := make([]byte, 8)
+	binary.BigEndian.PutUint64(ts, sct.timestamp)
+	buf = append(buf, ts...)
+	buf = append(buf, 0, 1) // log entry type: precert_entry
+	buf = append(buf, issuerKeyHash[:]...)
+	tbsLen := make([]byte, 3)
+	tbsLen[0] = byte(len(precertTBS) >> 16)
+	tbsLen[1] = byte(len(precertTBS) >> 8)
+	tbsLen[2] = byte(len(precertTBS))
+	buf = append(buf, tbsLen...)
+	buf = append(buf, precertTBS...)
+	extLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(extLen, uint16(len(sct.extensions)))
+	buf = append(buf, extLen...)
+	buf = append(buf, sct.extensions...)
+	return buf
+}
+
+// reconstructPrecertTBS reconstructs the DER encoding of the
+// TBSCertificate a CA would have submitted as part of cert's
+// precertificate, by taking cert's own TBSCertificate and dropping the
+// SCT list extension. RFC 6962 requires a CA to add that extension only
+// after it has obtained SCTs for the precertificate; every other
+// TBSCertificate field, including the serial number, validity and
+// subject, is identical between a precertificate and the final
+// certificate it becomes. That makes this sufficient to recompute the
+// "signed_entry" a precert-issued SCT's signature actually covers.
+func reconstructPrecertTBS(cert *x509.Certificate) ([]byte, error) {
+	var tbs asn1.RawValue
+	if _, err := asn1.Unmarshal(cert.RawTBSCertificate, &tbs); err != nil {
+		return nil, errors.Wrap(err, "ct: failed to parse TBSCertificate")
+	}
+	fields, err := splitRawSequence(tbs.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "ct: failed to split TBSCertificate fields")
+	}
+
+	extIdx := -1
+	for i, f := range fields {
+		if f.Class == asn1.ClassContextSpecific && f.Tag == 3 {
+			extIdx = i
+			break
+		}
+	}
+	if extIdx == -1 {
+		return nil, errors.New("ct: certificate carries no extensions to reconstruct a precertificate TBS from")
+	}
+
+	var extSeq asn1.RawValue
+	if _, err := asn1.Unmarshal(fields[extIdx].Bytes, &extSeq); err != nil {
+		return nil, errors.Wrap(err, "ct: failed to parse extensions SEQUENCE")
+	}
+	exts, err := splitRawSequence(extSeq.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "ct: failed to split extensions")
+	}
+
+	var filtered []asn1.RawValue
+	for _, e := range exts {
+		var ext pkix.Extension
+		if _, err := asn1.Unmarshal(e.FullBytes, &ext); err != nil {
+			return nil, errors.Wrap(err, "ct: failed to parse extension")
+		}
+		if ext.Id.Equal(sctListExtensionOID) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+
+	var newExtField []byte
+	if len(filtered) > 0 {
+		newExtSeq, err := marshalRawSequence(filtered)
+		if err != nil {
+			return nil, errors.Wrap(err, "ct: failed to re-marshal extensions")
+		}
+		newExtField, err = asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: newExtSeq})
+		if err != nil {
+			return nil, errors.Wrap(err, "ct: failed to re-marshal extensions field")
+		}
+	}
+
+	// If the SCT list was the only extension, the precertificate's
+	// TBSCertificate carried no extensions field at all -- omit it
+	// entirely rather than encoding an empty one.
+	var body []byte
+	for i, f := range fields {
+		if i == extIdx {
+			body = append(body, newExtField...)
+			continue
+		}
+		body = append(body, f.FullBytes...)
+	}
+	out, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: body})
+	if err != nil {
+		return nil, errors.Wrap(err, "ct: failed to re-marshal TBSCertificate")
+	}
+	return out, nil
+}
+
+// splitRawSequence returns the DER encoding of each top-level element
+// inside a SEQUENCE's content bytes.
+func splitRawSequence(body []byte) ([]asn1.RawValue, error) {
+	var values []asn1.RawValue
+	rest := body
+	for len(rest) > 0 {
+		var v asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// marshalRawSequence re-encodes values as a DER SEQUENCE, preserving
+// each element's original encoding.
+func marshalRawSequence(values []asn1.RawValue) ([]byte, error) {
+	var body []byte
+	for _, v := range values {
+		body = append(body, v.FullBytes...)
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: body})
+}
+
+// verifySCTs extracts the embedded SCT list from cert and checks that at
+// least conf.MinSCTs of them were issued by a log in conf.CTLogs and
+// verify against that log's public key. It is a no-op (returns nil) when
+// conf.MinSCTs is 0, so existing deployments that don't configure CTLogs
+// aren't affected.
+//
+// issuer is cert's parent in the chain. It's needed to verify the far
+// more common case of an SCT issued over the precertificate: verifying
+// that signature requires the hash of the issuing CA's public key, and
+// a reconstruction of the precertificate's TBSCertificate (see
+// reconstructPrecertTBS).
+func verifySCTs(cert, issuer *x509.Certificate) error {
+	if conf.MinSCTs == 0 {
+		return nil
+	}
+	scts, err := embeddedSCTs(cert)
+	if err != nil {
+		return err
+	}
+
+	valid := 0
+	for _, sct := range scts {
+		logConf := findCTLog(sct.logID)
+		if logConf == nil {
+			continue
+		}
+		if verifySCTSignature(sct, cert, issuer, logConf) {
+			valid++
+		}
+	}
+	if valid < conf.MinSCTs {
+		return errors.Errorf("found %d valid SCT(s) from trusted logs, policy requires at least %d", valid, conf.MinSCTs)
+	}
+	return nil
+}
+
+// embeddedSCTs extracts and parses cert's embedded SCT list, if any.
+func embeddedSCTs(cert *x509.Certificate) ([]signedCertificateTimestamp, error) {
+	var sctExt []byte
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(sctListExtensionOID) {
+			sctExt = ext.Value
+			break
+		}
+	}
+	if sctExt == nil {
+		return nil, errors.New("certificate carries no Signed Certificate Timestamps")
+	}
+	scts, err := parseSCTList(sctExt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse embedded SCT list")
+	}
+	return scts, nil
+}
+
+// sctCount returns the number of SCTs embedded in cert, or 0 if it
+// carries none, for use in MonitoringReport.
+func sctCount(cert *x509.Certificate) int {
+	scts, err := embeddedSCTs(cert)
+	if err != nil {
+		return 0
+	}
+	return len(scts)
+}
+
+func findCTLog(logID [32]byte) *CTLogConfig {
+	for i := range conf.CTLogs {
+		raw, err := base64.StdEncoding.DecodeString(conf.CTLogs[i].ID)
+		if err != nil || len(raw) != 32 {
+			continue
+		}
+		var id [32]byte
+		copy(id[:], raw)
+		if id == logID {
+			return &conf.CTLogs[i]
+		}
+	}
+	return nil
+}
+
+// verifySCTSignature checks sct's signature against logConf's public
+// key. It first tries the ordinary x509_entry leaf (the SCT was issued
+// over cert's own final bytes), then, if that fails and issuer is
+// known, the precert_entry leaf built from a reconstructed
+// precertificate TBSCertificate -- by far the more common way real CAs
+// obtain SCTs.
+func verifySCTSignature(sct signedCertificateTimestamp, cert, issuer *x509.Certificate, logConf *CTLogConfig) bool {
+	block, _ := pem.Decode([]byte(logConf.PublicKey))
+	if block == nil {
+		return false
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return false
+	}
+
+	if verifyLeafSignature(merkleTreeLeaf(sct, cert.Raw), sct.signature, pub) {
+		return true
+	}
+	if issuer == nil {
+		return false
+	}
+	precertTBS, err := reconstructPrecertTBS(cert)
+	if err != nil {
+		return false
+	}
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	return verifyLeafSignature(merkleTreeLeafPrecert(sct, issuerKeyHash, precertTBS), sct.signature, pub)
+}
+
+func verifyLeafSignature(leaf, signature []byte, pub interface{}) bool {
+	digest := sha256.Sum256(leaf)
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
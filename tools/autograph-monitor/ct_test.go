@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newTestCA returns a fresh self-signed ECDSA CA, standing in for the
+// issuer of a leaf certificate under test.
+func newTestCA(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ct test CA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// newTestCTLog returns a fresh ECDSA log key alongside the CTLogConfig
+// a deployment would use to trust it.
+func newTestCTLog(t *testing.T) (*ecdsa.PrivateKey, *CTLogConfig) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spki, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: spki})
+	logID := sha256.Sum256(spki)
+	return key, &CTLogConfig{
+		ID:        base64.StdEncoding.EncodeToString(logID[:]),
+		PublicKey: string(pemBytes),
+	}
+}
+
+// buildTestSCT signs leaf with logKey, returning a signedCertificateTimestamp
+// carrying that signature and logKey's own log ID.
+func buildTestSCT(t *testing.T, logKey *ecdsa.PrivateKey, leaf []byte, timestamp uint64) signedCertificateTimestamp {
+	t.Helper()
+	spki, err := x509.MarshalPKIXPublicKey(&logKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(leaf)
+	sig, err := ecdsa.SignASN1(rand.Reader, logKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signedCertificateTimestamp{
+		version:       0,
+		logID:         sha256.Sum256(spki),
+		timestamp:     timestamp,
+		hashAlgorithm: 4, // sha256
+		sigAlgorithm:  3, // ecdsa
+		signature:     sig,
+	}
+}
+
+// encodeSCT is the inverse of parseSCT, used to embed a test SCT into a
+// certificate's SCT list extension.
+func encodeSCT(sct signedCertificateTimestamp) []byte {
+	buf := []byte{sct.version}
+	buf = append(buf, sct.logID[:]...)
+	ts := make([]byte, 8)
+	binary.BigEndian.PutUint64(ts, sct.timestamp)
+	buf = append(buf, ts...)
+	extLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(extLen, uint16(len(sct.extensions)))
+	buf = append(buf, extLen...)
+	buf = append(buf, sct.extensions...)
+	buf = append(buf, sct.hashAlgorithm, sct.sigAlgorithm)
+	sigLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(sigLen, uint16(len(sct.signature)))
+	buf = append(buf, sigLen...)
+	buf = append(buf, sct.signature...)
+	return buf
+}
+
+// sctListExtensionValue builds the ASN.1 OCTET STRING content RFC 6962
+// section 3.3 requires for a certificate's SCT list extension, wrapping
+// a single SCT.
+func sctListExtensionValue(t *testing.T, sct signedCertificateTimestamp) []byte {
+	t.Helper()
+	entry := encodeSCT(sct)
+	entryWithLen := make([]byte, 2+len(entry))
+	binary.BigEndian.PutUint16(entryWithLen, uint16(len(entry)))
+	copy(entryWithLen[2:], entry)
+
+	listWithLen := make([]byte, 2+len(entryWithLen))
+	binary.BigEndian.PutUint16(listWithLen, uint16(len(entryWithLen)))
+	copy(listWithLen[2:], entryWithLen)
+
+	octet, err := asn1.Marshal(listWithLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return octet
+}
+
+func TestVerifySCTSignatureX509Entry(t *testing.T) {
+	caKey, ca := newTestCA(t)
+	logKey, logConf := newTestCTLog(t)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "x509_entry leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := merkleTreeLeaf(signedCertificateTimestamp{timestamp: 111}, cert.Raw)
+	sct := buildTestSCT(t, logKey, leaf, 111)
+
+	if !verifySCTSignature(sct, cert, ca, logConf) {
+		t.Fatal("expected an SCT issued over the final certificate's own bytes to verify")
+	}
+}
+
+// TestVerifySCTSignaturePrecertEntry covers the far more common real
+// world case: an SCT issued over the precertificate, before the SCT
+// list extension the final certificate carries even existed.
+func TestVerifySCTSignaturePrecertEntry(t *testing.T) {
+	caKey, ca := newTestCA(t)
+	logKey, logConf := newTestCTLog(t)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	precertTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "precert_entry leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	precertDER, err := x509.CreateCertificate(rand.Reader, precertTmpl, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	precert, err := x509.ParseCertificate(precertDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuerKeyHash := sha256.Sum256(ca.RawSubjectPublicKeyInfo)
+	leaf := merkleTreeLeafPrecert(signedCertificateTimestamp{timestamp: 222}, issuerKeyHash, precert.RawTBSCertificate)
+	sct := buildTestSCT(t, logKey, leaf, 222)
+
+	finalTmpl := *precertTmpl
+	finalTmpl.ExtraExtensions = []pkix.Extension{{Id: sctListExtensionOID, Value: sctListExtensionValue(t, sct)}}
+	finalDER, err := x509.CreateCertificate(rand.Reader, &finalTmpl, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finalCert, err := x509.ParseCertificate(finalDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !verifySCTSignature(sct, finalCert, ca, logConf) {
+		t.Fatal("expected a precert-issued SCT to verify against the reconstructed precertificate TBS")
+	}
+
+	saved := conf
+	conf.MinSCTs = 1
+	conf.CTLogs = []CTLogConfig{*logConf}
+	defer func() { conf = saved }()
+
+	if err := verifySCTs(finalCert, ca); err != nil {
+		t.Fatalf("verifySCTs failed: %v", err)
+	}
+}
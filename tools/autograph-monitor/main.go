@@ -0,0 +1,290 @@
+// autograph-monitor verifies content signatures returned by a running
+// autograph instance: that the certificate chain and signature are
+// valid, so ops can alert the moment a signer starts handing out
+// signatures nothing will actually trust. Its main loads the
+// configuration, builds the trust store and, when MonitorAddr is set,
+// serves the diagnostics HTTP endpoints; it does not itself request
+// signatures from autograph.
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// configuration holds the monitor's own settings, loaded from a yaml
+// file at startup
+type configuration struct {
+	// RootHash is the expected SHA-256 hash, colon-separated hex, of the
+	// trusted root certificate's DER encoding. Deprecated in favor of a
+	// pluggable trust store, but kept working for existing deployments.
+	RootHash string `yaml:"root_hash"`
+
+	// CTLogs lists the Certificate Transparency logs this monitor
+	// trusts to validate embedded SCTs against.
+	CTLogs []CTLogConfig `yaml:"ct_logs"`
+	// MinSCTs is the number of valid SCTs, from logs in CTLogs, an
+	// end-entity certificate must carry. 0 (the default) disables the
+	// policy entirely.
+	MinSCTs int `yaml:"min_scts"`
+
+	// Revocation configures CRL/OCSP revocation checking of the chain
+	Revocation RevocationConfig `yaml:"revocation"`
+
+	// TrustedRoots configures the pluggable, SPKI-pinned trust store.
+	// When unset, verifyRoot falls back to the legacy RootHash check.
+	TrustedRoots TrustedRootsConfig `yaml:"trusted_roots"`
+
+	// SignerPolicies configures, per signer ID, the EKU and SAN-suffix
+	// policy a content-signature chain for that signer must satisfy
+	// (see enforceSignerPolicy). Signers with no entry here aren't
+	// restricted.
+	SignerPolicies map[string]SignerPolicyConfig `yaml:"signer_policies"`
+
+	// MonitorAddr, when set, is the address the monitor's diagnostics
+	// HTTP server listens on, serving /__monitor__?format=json (see
+	// MonitoringReport) and /metrics. Left empty, no server is started.
+	MonitorAddr string `yaml:"monitor_addr"`
+}
+
+var conf configuration
+
+// trustStore is built from conf.TrustedRoots at startup; it stays nil
+// when TrustedRoots isn't configured, so verifyRoot can fall back to the
+// legacy conf.RootHash check.
+var trustStore TrustStore
+
+func main() {
+	var confPath string
+	flag.StringVar(&confPath, "c", "autograph-monitor.yaml", "path to the monitor configuration file")
+	flag.Parse()
+
+	data, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		log.Fatalf("failed to read configuration file %q: %v", confPath, err)
+	}
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		log.Fatalf("failed to parse configuration file %q: %v", confPath, err)
+	}
+	if conf.TrustedRoots.BundlePath != "" || len(conf.TrustedRoots.Pins) > 0 || len(conf.TrustedRoots.PerSigner) > 0 {
+		trustStore, err = NewPinnedTrustStore(conf.TrustedRoots)
+		if err != nil {
+			log.Fatalf("failed to build trusted roots store: %v", err)
+		}
+	}
+	if conf.MonitorAddr != "" {
+		log.Fatalf("monitoring HTTP server failed: %v", serveMonitoringHTTP(conf.MonitorAddr))
+	}
+}
+
+// signatureresponse is the shape of a single signing response returned
+// by autograph's /sign endpoints
+type signatureresponse struct {
+	Ref       string `json:"ref"`
+	Type      string `json:"type"`
+	Mode      string `json:"mode"`
+	SignerID  string `json:"signer_id"`
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+	X5U       string `json:"x5u"`
+}
+
+// verifyContentSignature retrieves the certificate chain referenced by
+// sig.X5U, verifies it, then verifies sig.Signature was produced by the
+// end-entity certificate at the head of that chain. Besides the error
+// it returns a MonitoringReport describing what it found, which is
+// recorded for the /__monitor__ endpoint and the autograph_chain_*
+// Prometheus gauges regardless of whether verification succeeded.
+func verifyContentSignature(sig signatureresponse) (*MonitoringReport, error) {
+	report := newMonitoringReport(sig.SignerID)
+
+	fetchStart := time.Now()
+	chain, err := getX5U(sig.X5U)
+	report.X5UFetchLatencyMS = time.Since(fetchStart).Milliseconds()
+	if err != nil {
+		err = errors.Wrap(err, "failed to retrieve certificate chain")
+		recordMonitoringReport(report, err)
+		return report, err
+	}
+
+	certs, err := checkChain(chain)
+	if err == nil {
+		err = enforceSignerPolicy(sig.SignerID, certs)
+	}
+	if err == nil {
+		err = verifyRootForSigner(sig.SignerID, certs[len(certs)-1])
+	}
+	report.addCertificates(certs)
+	if err != nil {
+		err = errors.Wrap(err, "certificate chain verification failed")
+		recordMonitoringReport(report, err)
+		return report, err
+	}
+
+	eeCert := certs[0]
+	eeKey, ok := eeCert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		err = errors.New("end-entity public key is not an ECDSA key")
+		recordMonitoringReport(report, err)
+		return report, err
+	}
+	sigBytes, err := base64.RawURLEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		err = errors.Wrap(err, "failed to decode base64url signature")
+		recordMonitoringReport(report, err)
+		return report, err
+	}
+	if len(sigBytes)%2 != 0 {
+		err = errors.New("signature has odd length, cannot split into r/s")
+		recordMonitoringReport(report, err)
+		return report, err
+	}
+	digest := sha256.Sum256(append([]byte("Content-Signature:\x00"), []byte(sig.Ref)...))
+	half := len(sigBytes) / 2
+	r := new(big.Int).SetBytes(sigBytes[:half])
+	s := new(big.Int).SetBytes(sigBytes[half:])
+	report.SignatureVerified = ecdsa.Verify(eeKey, digest[:], r, s)
+	if !report.SignatureVerified {
+		err = errors.New("signature does not verify with end-entity public key")
+	}
+	recordMonitoringReport(report, err)
+	return report, err
+}
+
+// getX5U fetches the PEM certificate chain at url
+func getX5U(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to fetch x5u")
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read x5u response body")
+	}
+	return string(body), nil
+}
+
+// verifyCertChain parses a PEM bundle (end-entity first, root last),
+// checks every certificate is signed by the next one in the chain, that
+// the end-entity isn't within 15 days of expiring, and that the root is
+// one this monitor trusts by default (see verifyRoot). Signers that need
+// their own set of allowed roots should use verifyCertChainForSigner.
+func verifyCertChain(chain string) error {
+	certs, err := checkChain(chain)
+	if err != nil {
+		return err
+	}
+	return verifyRoot(certs[len(certs)-1])
+}
+
+// verifyCertChainForSigner is identical to verifyCertChain, except it
+// also enforces signerID's SignerPolicyConfig (if any), and the root is
+// checked against the trust store's pins for signerID (falling back to
+// the default pins/legacy root hash when no per-signer override is
+// configured).
+func verifyCertChainForSigner(signerID, chain string) error {
+	certs, err := checkChain(chain)
+	if err != nil {
+		return err
+	}
+	if err := enforceSignerPolicy(signerID, certs); err != nil {
+		return err
+	}
+	return verifyRootForSigner(signerID, certs[len(certs)-1])
+}
+
+// checkChain parses a PEM bundle (end-entity first, root last) and runs
+// every check that doesn't depend on which roots a given signer trusts:
+// signature chaining, revocation, expiry and the SCT policy. It returns
+// the parsed chain so the caller can still check the root itself.
+func checkChain(chain string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(chain)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse certificate")
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) < 2 {
+		return nil, errors.Errorf("expected at least 2 certificates in chain, got %d", len(certs))
+	}
+	for i := 0; i < len(certs)-1; i++ {
+		if err := certs[i].CheckSignatureFrom(certs[i+1]); err != nil {
+			return nil, errors.Errorf("certificate %q is not signed by parent certificate %q", certs[i].Subject, certs[i+1].Subject)
+		}
+	}
+	for i := 0; i < len(certs)-1; i++ {
+		if err := checkRevocation(certs[i], certs[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	if time.Until(certs[0].NotAfter) < 15*24*time.Hour {
+		return nil, errors.Errorf("certificate %q expires in less than 15 days, on %s", certs[0].Subject, certs[0].NotAfter)
+	}
+	if err := verifySCTs(certs[0], certs[1]); err != nil {
+		return nil, errors.Wrap(err, "Signed Certificate Timestamp policy not met")
+	}
+	return certs, nil
+}
+
+// verifyRoot checks cert against the default trust store when one is
+// configured (conf.TrustedRoots), or falls back to the legacy
+// conf.RootHash single-hash comparison otherwise.
+func verifyRoot(cert *x509.Certificate) error {
+	if trustStore != nil {
+		if trustStore.Trusted(defaultTrustStoreSigner, cert) {
+			return nil
+		}
+		return errors.Errorf("root certificate with SPKI pin %s is not in the trusted roots", spkiPin(cert))
+	}
+	sum := sha256.Sum256(cert.Raw)
+	if formatHash(sum[:]) != conf.RootHash {
+		return errors.Errorf("root certificate hash does not match expected root: got %s", formatHash(sum[:]))
+	}
+	return nil
+}
+
+// verifyRootForSigner is like verifyRoot, but consults the per-signer
+// root pins configured for signerID before falling back to the default
+// pins / legacy root hash.
+func verifyRootForSigner(signerID string, cert *x509.Certificate) error {
+	if trustStore == nil {
+		return verifyRoot(cert)
+	}
+	if trustStore.Trusted(signerID, cert) {
+		return nil
+	}
+	return errors.Errorf("root certificate with SPKI pin %s is not an allowed root for signer %q", spkiPin(cert), signerID)
+}
+
+// formatHash renders a hash as the colon-separated uppercase hex string
+// used by conf.RootHash, e.g. "97:E8:BA:9C:..."
+func formatHash(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// chainExpiryGauge reports the number of seconds remaining before
+	// each certificate in a verified chain expires, so ops can alert on
+	// the same 15-day window checkChain enforces without scraping logs.
+	chainExpiryGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "autograph_chain_expiry_seconds",
+		Help: "Seconds until a certificate in a verified content-signature chain expires.",
+	}, []string{"signer", "depth"})
+
+	// chainVerifyErrorsTotal counts verifyContentSignature failures by
+	// coarse reason, so ops can alert on a rising rate of a specific
+	// failure mode.
+	chainVerifyErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "autograph_chain_verify_errors_total",
+		Help: "Total number of content-signature chain verification failures, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(chainExpiryGauge, chainVerifyErrorsTotal)
+}
+
+// recordChainMetrics folds report's per-certificate expiry into
+// autograph_chain_expiry_seconds, and, when err is non-nil, increments
+// autograph_chain_verify_errors_total under a coarse reason derived
+// from err.
+func recordChainMetrics(report *MonitoringReport, err error) {
+	for depth, cert := range report.Certificates {
+		seconds := time.Until(cert.NotAfter).Seconds()
+		chainExpiryGauge.WithLabelValues(report.SignerID, strconv.Itoa(depth)).Set(seconds)
+	}
+	if err != nil {
+		chainVerifyErrorsTotal.WithLabelValues(verifyErrorReason(err)).Inc()
+	}
+}
+
+// verifyErrorReason classifies err into one of a small set of stable
+// label values for autograph_chain_verify_errors_total, based on the
+// wrapping verifyContentSignature applies to each failure it can return.
+func verifyErrorReason(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "failed to retrieve certificate chain"):
+		return "fetch_failed"
+	case strings.Contains(msg, "certificate chain verification failed"):
+		return "chain_verification_failed"
+	case strings.Contains(msg, "signature does not verify"):
+		return "signature_mismatch"
+	default:
+		return "other"
+	}
+}
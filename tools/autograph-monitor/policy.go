@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/x509"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SignerPolicyConfig is the conf.SignerPolicies[signerID] yaml block. It
+// mirrors the Extended Key Usage and NameConstraints semantics Go's
+// x509 package already enforces for intermediates, but extends them to
+// the end-entity certificate, which content-signature verification
+// would otherwise never check.
+type SignerPolicyConfig struct {
+	// ExtKeyUsages lists the Extended Key Usages (by name, see
+	// extKeyUsageNames) every certificate in the chain must carry.
+	ExtKeyUsages []string `yaml:"ext_key_usages"`
+	// PermittedDNSSuffixes restricts the end-entity's SAN DNS names to
+	// those ending in one of these suffixes.
+	PermittedDNSSuffixes []string `yaml:"permitted_dns_suffixes"`
+}
+
+var extKeyUsageNames = map[string]x509.ExtKeyUsage{
+	"any":             x509.ExtKeyUsageAny,
+	"serverAuth":      x509.ExtKeyUsageServerAuth,
+	"clientAuth":      x509.ExtKeyUsageClientAuth,
+	"codeSigning":     x509.ExtKeyUsageCodeSigning,
+	"emailProtection": x509.ExtKeyUsageEmailProtection,
+	"timeStamping":    x509.ExtKeyUsageTimeStamping,
+	"ocspSigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// enforceSignerPolicy checks certs (end-entity first, parent last, as
+// returned by checkChain) against the SignerPolicyConfig configured for
+// signerID. Signers with no entry in conf.SignerPolicies aren't
+// restricted and this is a no-op.
+func enforceSignerPolicy(signerID string, certs []*x509.Certificate) error {
+	policy, ok := conf.SignerPolicies[signerID]
+	if !ok {
+		return nil
+	}
+	for _, name := range policy.ExtKeyUsages {
+		eku, ok := extKeyUsageNames[name]
+		if !ok {
+			return errors.Errorf("signer %q policy references unknown extended key usage %q", signerID, name)
+		}
+		for _, cert := range certs {
+			if !hasExtKeyUsage(cert, eku) {
+				return errors.Errorf("certificate %q lacks required extended key usage %q for signer %q", cert.Subject, name, signerID)
+			}
+		}
+	}
+	if len(policy.PermittedDNSSuffixes) > 0 {
+		for _, dnsName := range certs[0].DNSNames {
+			if !dnsNamePermitted(dnsName, policy.PermittedDNSSuffixes) {
+				return errors.Errorf("name %q not permitted for signer %q", dnsName, signerID)
+			}
+		}
+	}
+	return nil
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, want x509.ExtKeyUsage) bool {
+	for _, eku := range cert.ExtKeyUsage {
+		if eku == want || eku == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+func dnsNamePermitted(name string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func makePolicyTestChain(t *testing.T, eeDNSName string, intermediateEKU []x509.ExtKeyUsage) []*x509.Certificate {
+	t.Helper()
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerTpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test policy issuer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		ExtKeyUsage:  intermediateEKU,
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, issuerTpl, issuerTpl, &issuerKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := x509.ParseCertificate(issuerDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eeKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eeTpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: eeDNSName},
+		DNSNames:     []string{eeDNSName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(30 * 24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	eeDER, err := x509.CreateCertificate(rand.Reader, eeTpl, issuer, &eeKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ee, err := x509.ParseCertificate(eeDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*x509.Certificate{ee, issuer}
+}
+
+func TestEnforceSignerPolicyDNSSuffix(t *testing.T) {
+	conf.SignerPolicies = map[string]SignerPolicyConfig{
+		"normankey": {
+			ExtKeyUsages:         []string{"codeSigning"},
+			PermittedDNSSuffixes: []string{".content-signature.mozilla.org"},
+		},
+	}
+	defer func() { conf.SignerPolicies = nil }()
+
+	certs := makePolicyTestChain(t, "normandy.content-signature.mozilla.org", []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning})
+	if err := enforceSignerPolicy("normankey", certs); err != nil {
+		t.Fatalf("Expected permitted name to pass policy, but failed with: %v", err)
+	}
+
+	certs = makePolicyTestChain(t, "evil.example.com", []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning})
+	err := enforceSignerPolicy("normankey", certs)
+	if err == nil {
+		t.Fatal("Expected disallowed name to fail policy, but it passed")
+	}
+	if !strings.Contains(err.Error(), "not permitted for signer") {
+		t.Fatalf("Expected a 'name not permitted for signer' error, got: %v", err)
+	}
+}
+
+func TestEnforceSignerPolicyMissingEKU(t *testing.T) {
+	conf.SignerPolicies = map[string]SignerPolicyConfig{
+		"normankey": {
+			ExtKeyUsages: []string{"codeSigning"},
+		},
+	}
+	defer func() { conf.SignerPolicies = nil }()
+
+	certs := makePolicyTestChain(t, "normandy.content-signature.mozilla.org", []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+	err := enforceSignerPolicy("normankey", certs)
+	if err == nil {
+		t.Fatal("Expected chain with an intermediate lacking codeSigning EKU to fail policy, but it passed")
+	}
+	if !strings.Contains(err.Error(), "lacks required extended key usage") {
+		t.Fatalf("Expected a 'lacks required extended key usage' error, got: %v", err)
+	}
+}
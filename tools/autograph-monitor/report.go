@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// CertReport summarizes one certificate of a verified content-signature
+// chain for MonitoringReport.
+type CertReport struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	SPKIPin   string    `json:"spki_pin"`
+	SANs      []string  `json:"sans,omitempty"`
+}
+
+// MonitoringReport is the machine-readable outcome of one
+// verifyContentSignature call: enough detail to alert on an impending
+// chain expiry, a revoked end-entity or a verification failure without
+// scraping log strings. It is exposed over /__monitor__?format=json and
+// folded into the autograph_chain_* Prometheus gauges by
+// recordMonitoringReport.
+type MonitoringReport struct {
+	SignerID          string       `json:"signer_id"`
+	GeneratedAt       time.Time    `json:"generated_at"`
+	ChainLength       int          `json:"chain_length"`
+	Certificates      []CertReport `json:"certificates,omitempty"`
+	SCTCount          int          `json:"sct_count"`
+	OCSPStatus        string       `json:"ocsp_status"`
+	X5UFetchLatencyMS int64        `json:"x5u_fetch_latency_ms"`
+	SignatureVerified bool         `json:"signature_verified"`
+	Error             string       `json:"error,omitempty"`
+}
+
+func newMonitoringReport(signerID string) *MonitoringReport {
+	return &MonitoringReport{
+		SignerID:   signerID,
+		OCSPStatus: "not_checked",
+	}
+}
+
+// addCertificates fills in the report's chain-derived fields from certs
+// (end-entity first, as returned by checkChain). It is a no-op when
+// certs is empty, e.g. when the chain couldn't even be parsed.
+func (r *MonitoringReport) addCertificates(certs []*x509.Certificate) {
+	r.ChainLength = len(certs)
+	for _, cert := range certs {
+		r.Certificates = append(r.Certificates, CertReport{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+			SPKIPin:   spkiPin(cert),
+			SANs:      cert.DNSNames,
+		})
+	}
+	if len(certs) == 0 {
+		return
+	}
+	r.SCTCount = sctCount(certs[0])
+	if len(certs) > 1 {
+		r.OCSPStatus = ocspStatusFor(certs[0], certs[1])
+	}
+}
+
+// ocspStatusFor reports cert's OCSP revocation status as seen against
+// issuer, for display in a MonitoringReport: "good", "revoked", or
+// "unknown" when no responder could be reached. It does not affect
+// verification itself, which already happened via checkRevocation.
+func ocspStatusFor(cert, issuer *x509.Certificate) string {
+	revoked, checked, err := isRevokedByOCSP(cert, issuer)
+	if err != nil || !checked {
+		return "unknown"
+	}
+	if revoked {
+		return "revoked"
+	}
+	return "good"
+}
+
+var (
+	lastReportsMu sync.Mutex
+	lastReports   = make(map[string]*MonitoringReport)
+)
+
+// recordMonitoringReport stamps report, stores it as the latest report
+// for its signer (for /__monitor__?format=json) and folds it into the
+// autograph_chain_* Prometheus gauges.
+func recordMonitoringReport(report *MonitoringReport, err error) {
+	report.GeneratedAt = time.Now()
+	if err != nil {
+		report.Error = err.Error()
+	}
+	lastReportsMu.Lock()
+	lastReports[report.SignerID] = report
+	lastReportsMu.Unlock()
+	recordChainMetrics(report, err)
+}
+
+// handleMonitorReport serves the latest MonitoringReport for every
+// signer checked so far as JSON, at /__monitor__?format=json. Any other
+// (or missing) format parameter is rejected, since JSON is currently
+// the only machine-readable representation this endpoint offers.
+func handleMonitorReport(w http.ResponseWriter, r *http.Request) {
+	if format := r.URL.Query().Get("format"); format != "json" {
+		http.Error(w, `unsupported or missing "format" parameter, only "format=json" is supported`, http.StatusBadRequest)
+		return
+	}
+	lastReportsMu.Lock()
+	reports := make([]*MonitoringReport, 0, len(lastReports))
+	for _, report := range lastReports {
+		reports = append(reports, report)
+	}
+	lastReportsMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reports); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveMonitoringHTTP starts the monitor's diagnostics HTTP server,
+// exposing /__monitor__?format=json (see handleMonitorReport) and
+// /metrics (Prometheus). It blocks; callers typically run it in its own
+// goroutine.
+func serveMonitoringHTTP(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/__monitor__", handleMonitorReport)
+	mux.Handle("/metrics", promhttp.Handler())
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// RevocationMode selects how verifyCertChain reacts to a revocation
+// check it cannot complete (CDP/OCSP responder down, network error,
+// stale CRL, etc), mirroring RFC 5280's soft-fail/hard-fail language.
+type RevocationMode string
+
+const (
+	// RevocationOff skips revocation checking entirely
+	RevocationOff RevocationMode = "off"
+	// RevocationSoftFail only fails the chain on a confirmed revocation;
+	// an unreachable CDP/responder is silently ignored
+	RevocationSoftFail RevocationMode = "soft-fail"
+	// RevocationHardFail fails the chain both on a confirmed revocation
+	// and when revocation status could not be determined at all
+	RevocationHardFail RevocationMode = "hard-fail"
+)
+
+// RevocationConfig is the conf.Revocation yaml block
+type RevocationConfig struct {
+	Mode RevocationMode `yaml:"mode"`
+}
+
+// revocationCacheEntry records a previously fetched CRL's revoked serials,
+// valid until NextUpdate
+type revocationCacheEntry struct {
+	revoked    map[string]bool
+	nextUpdate time.Time
+}
+
+var (
+	revocationCacheMu sync.Mutex
+	revocationCache   = make(map[string]revocationCacheEntry) // keyed by CDP URL
+)
+
+// checkRevocation verifies that cert (issued by issuer) has not been
+// revoked, per conf.Revocation.Mode. An "indeterminate" result (no CDP
+// or OCSP responder configured, or both unreachable) is treated
+// according to Mode: silently accepted under soft-fail, rejected under
+// hard-fail.
+func checkRevocation(cert, issuer *x509.Certificate) error {
+	mode := conf.Revocation.Mode
+	if mode == "" || mode == RevocationOff {
+		return nil
+	}
+
+	revoked, checked, err := isRevokedByCRL(cert, issuer)
+	if err == nil && checked {
+		if revoked {
+			return errors.Errorf("certificate %q is revoked (CRL)", cert.Subject)
+		}
+		return nil
+	}
+
+	revoked, checked, ocspErr := isRevokedByOCSP(cert, issuer)
+	if ocspErr == nil && checked {
+		if revoked {
+			return errors.Errorf("certificate %q is revoked (OCSP)", cert.Subject)
+		}
+		return nil
+	}
+
+	if mode == RevocationHardFail {
+		return errors.Errorf("could not determine revocation status of %q: CRL error: %v, OCSP error: %v", cert.Subject, err, ocspErr)
+	}
+	return nil
+}
+
+func isRevokedByCRL(cert, issuer *x509.Certificate) (revoked bool, checked bool, err error) {
+	for _, cdp := range cert.CRLDistributionPoints {
+		entry, err := getCRL(cdp, issuer)
+		if err != nil {
+			continue
+		}
+		if entry.revoked[cert.SerialNumber.String()] {
+			return true, true, nil
+		}
+		checked = true
+	}
+	if !checked {
+		return false, false, errors.New("no usable CRL distribution point")
+	}
+	return false, true, nil
+}
+
+func getCRL(url string, issuer *x509.Certificate) (revocationCacheEntry, error) {
+	revocationCacheMu.Lock()
+	entry, ok := revocationCache[url]
+	revocationCacheMu.Unlock()
+	if ok && time.Now().Before(entry.nextUpdate) {
+		return entry, nil
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return entry, errors.Wrap(err, "failed to fetch CRL")
+	}
+	defer resp.Body.Close()
+	der, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return entry, errors.Wrap(err, "failed to read CRL response")
+	}
+
+	list, err := x509.ParseCRL(der)
+	if err != nil {
+		return entry, errors.Wrap(err, "failed to parse CRL")
+	}
+	if issuer != nil {
+		if err := issuer.CheckCRLSignature(list); err != nil {
+			return entry, errors.Wrap(err, "CRL signature does not verify against issuer")
+		}
+	}
+
+	entry = revocationCacheEntry{
+		revoked:    revokedSerials(list.TBSCertList.RevokedCertificates),
+		nextUpdate: list.TBSCertList.NextUpdate,
+	}
+	revocationCacheMu.Lock()
+	revocationCache[url] = entry
+	revocationCacheMu.Unlock()
+	return entry, nil
+}
+
+func revokedSerials(revoked []pkix.RevokedCertificate) map[string]bool {
+	set := make(map[string]bool, len(revoked))
+	for _, r := range revoked {
+		set[r.SerialNumber.String()] = true
+	}
+	return set
+}
+
+func isRevokedByOCSP(cert, issuer *x509.Certificate) (revoked bool, checked bool, err error) {
+	if len(cert.OCSPServer) == 0 || issuer == nil {
+		return false, false, errors.New("no OCSP responder configured")
+	}
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return false, false, errors.Wrap(err, "failed to build OCSP request")
+	}
+	for _, responder := range cert.OCSPServer {
+		httpResp, err := http.Post(responder, "application/ocsp-request", bytes.NewReader(req))
+		if err != nil {
+			continue
+		}
+		body, err := ioutil.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		if err != nil {
+			continue
+		}
+		ocspResp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+		if err != nil {
+			continue
+		}
+		if time.Now().After(ocspResp.NextUpdate) {
+			continue
+		}
+		return ocspResp.Status == ocsp.Revoked, true, nil
+	}
+	return false, false, errors.New("all OCSP responders were unreachable or returned an unusable response")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckRevocationCRL(t *testing.T) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerTpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test revocation issuer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, issuerTpl, issuerTpl, &issuerKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := x509.ParseCertificate(issuerDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eeSerial := big.NewInt(42)
+	eeTpl := &x509.Certificate{
+		SerialNumber: eeSerial,
+		Subject:      pkix.Name{CommonName: "test revoked ee"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	crlServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		crlDER, err := issuer.CreateCRL(rand.Reader, issuerKey, []pkix.RevokedCertificate{
+			{SerialNumber: eeSerial, RevocationTime: time.Now()},
+		}, time.Now(), time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(crlDER)
+	}))
+	defer crlServer.Close()
+
+	eeTpl.CRLDistributionPoints = []string{crlServer.URL}
+	eeDER, err := x509.CreateCertificate(rand.Reader, eeTpl, issuer, &issuerKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ee, err := x509.ParseCertificate(eeDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf.Revocation.Mode = RevocationHardFail
+	defer func() { conf.Revocation.Mode = "" }()
+
+	err = checkRevocation(ee, issuer)
+	if err == nil {
+		t.Fatal("expected revoked certificate to fail revocation check, but it passed")
+	}
+	if !strings.Contains(err.Error(), "is revoked") {
+		t.Fatalf("expected a 'is revoked' error, got: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// defaultTrustStoreSigner is used to look up the default (non-per-signer)
+// pin set when callers don't care about per-signer overrides, e.g.
+// verifyRoot's legacy single-chain callers.
+const defaultTrustStoreSigner = ""
+
+// TrustStore decides whether a root certificate is trusted for a given
+// signer ID, replacing the single conf.RootHash comparison with a set of
+// SPKI pins that can be overridden per signer (Normandy, AMO, staging,
+// etc each declaring their own acceptable roots).
+type TrustStore interface {
+	Trusted(signerID string, root *x509.Certificate) bool
+}
+
+// TrustedRootsConfig is the conf.TrustedRoots yaml block.
+type TrustedRootsConfig struct {
+	// BundlePath is a path to a PEM file of one or more trusted roots
+	BundlePath string `yaml:"bundle_path"`
+	// Pins is an inline list of hex SHA-256 SPKI pins, trusted for every
+	// signer unless overridden in PerSigner
+	Pins []string `yaml:"pins"`
+	// PerSigner maps a signer ID to the list of hex SPKI pins that
+	// signer's chains must terminate in, overriding Pins entirely for
+	// that signer.
+	PerSigner map[string][]string `yaml:"per_signer"`
+}
+
+// pinnedTrustStore is the default TrustStore implementation: every root
+// is checked by the SHA-256 hash of its SubjectPublicKeyInfo, the same
+// pinning shape browsers use for HPKP/static pin sets.
+type pinnedTrustStore struct {
+	defaultPins map[string]bool
+	perSigner   map[string]map[string]bool
+}
+
+// NewPinnedTrustStore builds a TrustStore from a TrustedRootsConfig,
+// loading roots from cfg.BundlePath (if set) in addition to the inline
+// cfg.Pins, and building a separate pin set per entry in cfg.PerSigner.
+func NewPinnedTrustStore(cfg TrustedRootsConfig) (*pinnedTrustStore, error) {
+	ts := &pinnedTrustStore{
+		defaultPins: make(map[string]bool),
+		perSigner:   make(map[string]map[string]bool),
+	}
+	for _, pin := range cfg.Pins {
+		ts.defaultPins[pin] = true
+	}
+	if cfg.BundlePath != "" {
+		data, err := ioutil.ReadFile(cfg.BundlePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read trusted roots bundle %q", cfg.BundlePath)
+		}
+		pins, err := pinsFromPEMBundle(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, pin := range pins {
+			ts.defaultPins[pin] = true
+		}
+	}
+	for signerID, pins := range cfg.PerSigner {
+		set := make(map[string]bool, len(pins))
+		for _, pin := range pins {
+			set[pin] = true
+		}
+		ts.perSigner[signerID] = set
+	}
+	return ts, nil
+}
+
+func pinsFromPEMBundle(data []byte) ([]string, error) {
+	var pins []string
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse a certificate in the trusted roots bundle")
+		}
+		pins = append(pins, spkiPin(cert))
+	}
+	return pins, nil
+}
+
+// Trusted reports whether root's SPKI pin is allowed for signerID: the
+// per-signer pin set if one is configured for signerID, or the default
+// pin set otherwise.
+func (ts *pinnedTrustStore) Trusted(signerID string, root *x509.Certificate) bool {
+	pin := spkiPin(root)
+	if pins, ok := ts.perSigner[signerID]; ok {
+		return pins[pin]
+	}
+	return ts.defaultPins[pin]
+}
+
+// spkiPin returns the hex-encoded SHA-256 hash of cert's
+// SubjectPublicKeyInfo, the pinning format used throughout TrustedRootsConfig.
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"crypto/x509"
+)
+
+func TestPinnedTrustStorePerSigner(t *testing.T) {
+	prodBlock, _ := pem.Decode(FirefoxPKIRootPEM)
+	if prodBlock == nil {
+		t.Fatalf("Failed to parse certificate PEM")
+	}
+	prodRoot, err := x509.ParseCertificate(prodBlock.Bytes)
+	if err != nil {
+		t.Fatalf("Could not parse X.509 certificate: %v", err)
+	}
+
+	stagingBlock, _ := pem.Decode(FirefoxPKIStagingRootPEM)
+	if stagingBlock == nil {
+		t.Fatalf("Failed to parse certificate PEM")
+	}
+	stagingRoot, err := x509.ParseCertificate(stagingBlock.Bytes)
+	if err != nil {
+		t.Fatalf("Could not parse X.509 certificate: %v", err)
+	}
+
+	ts, err := NewPinnedTrustStore(TrustedRootsConfig{
+		Pins: []string{spkiPin(prodRoot)},
+		PerSigner: map[string][]string{
+			"normankey-staging": {spkiPin(stagingRoot)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build trust store: %v", err)
+	}
+
+	if !ts.Trusted("normankey", prodRoot) {
+		t.Fatal("Expected production root to be trusted for a signer without a per-signer override")
+	}
+	if ts.Trusted("normankey", stagingRoot) {
+		t.Fatal("Expected staging root to be rejected for a signer without a per-signer override")
+	}
+	if !ts.Trusted("normankey-staging", stagingRoot) {
+		t.Fatal("Expected staging root to be trusted for its per-signer override")
+	}
+	if ts.Trusted("normankey-staging", prodRoot) {
+		t.Fatal("Expected production root to be rejected once a per-signer override replaces the default pins")
+	}
+}
+
+func TestPinnedTrustStoreBundlePath(t *testing.T) {
+	f, err := ioutil.TempFile("", "trusted-roots-*.pem")
+	if err != nil {
+		t.Fatalf("Failed to create temp bundle file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(FirefoxPKIRootPEM); err != nil {
+		t.Fatalf("Failed to write temp bundle file: %v", err)
+	}
+	f.Close()
+
+	block, _ := pem.Decode(FirefoxPKIRootPEM)
+	root, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Could not parse X.509 certificate: %v", err)
+	}
+
+	ts, err := NewPinnedTrustStore(TrustedRootsConfig{BundlePath: f.Name()})
+	if err != nil {
+		t.Fatalf("Failed to build trust store from bundle: %v", err)
+	}
+	if !ts.Trusted(defaultTrustStoreSigner, root) {
+		t.Fatal("Expected root loaded from bundle path to be trusted")
+	}
+}
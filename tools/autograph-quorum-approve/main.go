@@ -0,0 +1,124 @@
+// autograph-quorum-approve lets a delegator approve or deny a pending
+// quorum signing job from the command line, by POSTing a signed
+// ApprovalToken to a running autograph instance's
+// /quorum/approve/{jobid} endpoint.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+
+	"go.mozilla.org/autograph/quorum"
+)
+
+func main() {
+	var (
+		server      string
+		jobID       string
+		approverID  string
+		secret      string
+		shareKeyHex string
+		deny        bool
+	)
+	flag.StringVar(&server, "server", "http://localhost:8000", "base URL of the autograph instance to approve against")
+	flag.StringVar(&jobID, "job", "", "id of the pending quorum job to decide on")
+	flag.StringVar(&approverID, "approver", "", "this approver's id, as configured in the signer's quorum policy")
+	flag.StringVar(&secret, "secret", "", "this approver's shared secret")
+	flag.StringVar(&shareKeyHex, "share-key", "", "hex-encoded X25519 private key matching this approver's SharePublicKey; required to approve, ignored for -deny")
+	flag.BoolVar(&deny, "deny", false, "deny the job instead of approving it")
+	flag.Parse()
+
+	if jobID == "" || approverID == "" || secret == "" {
+		log.Fatal("-job, -approver and -secret are all required")
+	}
+	if !deny && shareKeyHex == "" {
+		log.Fatal("-share-key is required to approve (only -deny can omit it)")
+	}
+
+	decision := quorum.DecisionApprove
+	if deny {
+		decision = quorum.DecisionDeny
+	}
+
+	var share []byte
+	if !deny {
+		share = fetchAndDecryptShare(server, jobID, approverID, shareKeyHex)
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		log.Fatalf("failed to generate nonce: %v", err)
+	}
+	token := quorum.ApprovalToken{
+		ApproverID: approverID,
+		Decision:   decision,
+		Timestamp:  time.Now().Unix(),
+		Nonce:      hex.EncodeToString(nonce),
+		Share:      share,
+	}
+	token.Sign(jobID, secret)
+
+	body, err := json.Marshal(token)
+	if err != nil {
+		log.Fatalf("failed to serialize approval token: %v", err)
+	}
+	resp, err := http.Post(server+"/quorum/approve/"+jobID, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Fatalf("failed to submit approval: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("approval rejected (%s): %s", resp.Status, respBody)
+	}
+	fmt.Printf("%s\n", respBody)
+}
+
+// fetchAndDecryptShare fetches jobID's pending state from the server
+// and opens approverID's EncryptedShares entry with the private key
+// decoded from shareKeyHex. The server never sees that private key; the
+// plaintext share recovered here reaches it only as token.Share,
+// submitted to /quorum/approve.
+func fetchAndDecryptShare(server, jobID, approverID, shareKeyHex string) []byte {
+	privBytes, err := hex.DecodeString(shareKeyHex)
+	if err != nil || len(privBytes) != 32 {
+		log.Fatal("-share-key must be a 32-byte hex-encoded X25519 private key")
+	}
+	var priv, pub [32]byte
+	copy(priv[:], privBytes)
+	curve25519.ScalarBaseMult(&pub, &priv)
+
+	resp, err := http.Get(server + "/quorum/jobs/" + jobID)
+	if err != nil {
+		log.Fatalf("failed to fetch pending job: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Fatalf("failed to fetch pending job (%s): %s", resp.Status, body)
+	}
+	var job quorum.PendingJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		log.Fatalf("failed to decode pending job: %v", err)
+	}
+	sealed, ok := job.EncryptedShares[approverID]
+	if !ok {
+		log.Fatalf("job %s has no encrypted share for approver %q", jobID, approverID)
+	}
+	share, ok := box.OpenAnonymous(nil, sealed.SealedBox, &pub, &priv)
+	if !ok {
+		log.Fatal("failed to decrypt share: wrong -share-key for this approver")
+	}
+	return share
+}